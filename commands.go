@@ -0,0 +1,235 @@
+package datahubdeployment
+
+import (
+	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
+	"github.com/spf13/cobra"
+)
+
+var deployCmd = &cobra.Command{
+	Use:   "deploy [datahub]",
+	Short: "Deploy the config files to the datahub",
+	Long: `Diffs the config files against the manifest in the datahub and executes the resulting operations.
+Runs as a dry run unless --dry-run=false is given.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		app := newApp(cmd, args)
+		err := app.Run()
+		utils.HandleError(err)
+	},
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Lint the config files without connecting to the datahub",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		app := newApp(cmd, nil)
+		err := app.Validate()
+		utils.HandleError(err)
+	},
+}
+
+var variablesCmd = &cobra.Command{
+	Use:   "variables",
+	Short: "Show the merged variables of the env files, and the file each value came from",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		app := newApp(cmd, nil)
+		err := app.Variables()
+		utils.HandleError(err)
+	},
+}
+
+var renderCmd = &cobra.Command{
+	Use:   "render [files...]",
+	Short: "Print the templated config files without connecting to the datahub",
+	Long: `Applies includes and variables from the env file to the config files and prints the result.
+If no files are given, every config file is rendered. With --output-path the rendered files, and
+the transforms, are written to a mirror of the config directory instead.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		app := newApp(cmd, nil)
+		err := app.Render(args)
+		utils.HandleError(err)
+	},
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [datahub]",
+	Short: "Show the changes a deployment would make",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		app := newApp(cmd, args)
+		err := app.Diff()
+		utils.HandleError(err)
+	},
+}
+
+var driftCmd = &cobra.Command{
+	Use:   "drift [datahub]",
+	Short: "Detect jobs and content changed directly in the datahub",
+	Long: `Compares every job and content owned by the manifest with its live version in the datahub,
+and reports the configs that are modified or missing. Use --repair to restore them from the manifest.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		repair, _ := cmd.Flags().GetBool("repair")
+		app := newApp(cmd, args)
+		err := app.Drift(repair)
+		utils.HandleError(err)
+	},
+}
+
+var planCmd = &cobra.Command{
+	Use:   "plan [datahub]",
+	Short: "Compute the deployment operations and save them to a plan file",
+	Long: `Diffs the config files against the manifest in the datahub and writes the operations to a plan file,
+without changing the datahub. The plan can be executed later with the apply command.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		planFile, _ := cmd.Flags().GetString("plan-file")
+		app := newApp(cmd, args)
+		err := app.WritePlan(planFile)
+		utils.HandleError(err)
+	},
+}
+
+var applyCmd = &cobra.Command{
+	Use:   "apply [datahub]",
+	Short: "Execute the operations of a saved plan file",
+	Long: `Executes exactly the operations of a plan file made with the plan command. The transforms are stored in
+the plan, so the apply does not read the transform files. The apply is refused if the plan was made for another
+datahub or manifest, if the manifest in the datahub changed after the plan was made, or if a config holding
+secrets changed, as the secrets are read from the config files again.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		planFile, _ := cmd.Flags().GetString("plan-file")
+		app := newApp(cmd, args)
+		err := app.ApplyPlan(planFile)
+		utils.HandleError(err)
+	},
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history [datahub]",
+	Short: "List the past deployments of the manifest, or show the operations of one deployment",
+	Long: `Every deployment that is not a dry run is recorded in the DatahubConfigHistory dataset, with the commit,
+the user or ci run deploying it, the env files and the result of every operation. Use --show with a deployment
+from the list to see its operations.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		show, _ := cmd.Flags().GetString("show")
+		limit, _ := cmd.Flags().GetInt("limit")
+		app := newConnectedApp(cmd, args)
+		err := app.History(show, limit)
+		utils.HandleError(err)
+	},
+}
+
+var rollbackCmd = &cobra.Command{
+	Use:   "rollback [datahub]",
+	Short: "Return the datahub to the manifest of a previous deployment",
+	Long: `Diffs the manifest stored with a previous deployment in the history against the manifest in the datahub,
+and executes the operations, restoring the javascript transforms deployed with it. Configs holding secrets
+can not be restored, as the history does not store them.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		to, _ := cmd.Flags().GetString("to")
+		app := newApp(cmd, args)
+		err := app.RollbackTo(to)
+		utils.HandleError(err)
+	},
+}
+
+var manifestCmd = &cobra.Command{
+	Use:   "manifest",
+	Short: "Show, export or import the manifest stored in the datahub",
+}
+
+var manifestShowCmd = &cobra.Command{
+	Use:   "show [datahub]",
+	Short: "Print the manifest stored in the datahub",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		app := newConnectedApp(cmd, args)
+		err := app.M.ShowManifest()
+		utils.HandleError(err)
+	},
+}
+
+var manifestExportCmd = &cobra.Command{
+	Use:   "export [datahub]",
+	Short: "Write the manifest stored in the datahub to a file",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("file")
+		app := newConnectedApp(cmd, args)
+		err := app.M.ExportManifest(file)
+		utils.HandleError(err)
+	},
+}
+
+var manifestImportCmd = &cobra.Command{
+	Use:   "import [datahub]",
+	Short: "Replace the manifest stored in the datahub with a manifest file",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		file, _ := cmd.Flags().GetString("file")
+		app := newConnectedApp(cmd, args)
+		err := app.M.ImportManifest(file)
+		utils.HandleError(err)
+	},
+}
+
+var manifestForceUnlockCmd = &cobra.Command{
+	Use:   "force-unlock [datahub]",
+	Short: "Remove the lock of the manifest left by a deployment that is no longer running",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		app := newConnectedApp(cmd, args)
+		err := app.M.ForceUnlock()
+		utils.HandleError(err)
+	},
+}
+
+var manifestOwnersCmd = &cobra.Command{
+	Use:   "owners [datahub]",
+	Short: "Show the manifest owning every config in the datahub",
+	Long: `Reads every manifest in the datahub and prints the manifest owning each job, content and dataset.
+Configs owned by more than one manifest are reported, as deployments refuse to change them.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		app := newConnectedApp(cmd, args)
+		err := app.M.ShowOwners()
+		utils.HandleError(err)
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(deployCmd)
+	RootCmd.AddCommand(validateCmd)
+	RootCmd.AddCommand(renderCmd)
+	RootCmd.AddCommand(variablesCmd)
+	RootCmd.AddCommand(diffCmd)
+
+	driftCmd.Flags().Bool("repair", false, "Restore drifted configs to the version in the manifest")
+	RootCmd.AddCommand(driftCmd)
+
+	historyCmd.Flags().String("show", "", "Deployment to show the operations of")
+	historyCmd.Flags().Int("limit", 20, "Number of deployments to list, 0 lists all")
+	RootCmd.AddCommand(historyCmd)
+
+	rollbackCmd.Flags().String("to", "", "Deployment to roll back to, as listed by the history command")
+	_ = rollbackCmd.MarkFlagRequired("to")
+	RootCmd.AddCommand(rollbackCmd)
+
+	planCmd.Flags().String("plan-file", "mim-deploy.plan.json", "Path of the plan file to write")
+	RootCmd.AddCommand(planCmd)
+
+	applyCmd.Flags().String("plan-file", "mim-deploy.plan.json", "Path of the plan file to apply")
+	applyCmd.Flags().Bool("dry-run", false, "If set to true, only show the operations of the plan without applying them")
+	RootCmd.AddCommand(applyCmd)
+
+	manifestExportCmd.Flags().StringP("file", "f", "manifest.json", "File to write the manifest to")
+	manifestImportCmd.Flags().StringP("file", "f", "manifest.json", "Manifest file to import")
+	manifestCmd.AddCommand(manifestShowCmd, manifestExportCmd, manifestImportCmd, manifestOwnersCmd, manifestForceUnlockCmd)
+	RootCmd.AddCommand(manifestCmd)
+}
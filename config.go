@@ -7,27 +7,40 @@ import (
 	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
 	"os"
+	"time"
 )
 
-// rootCmd represents the base command when called without any subcommands
+// rootCmd represents the base command when called without any subcommands, it deploys like the deploy command
 var RootCmd = &cobra.Command{
-	Use:   "mim-deploy",
+	Use:   "mim-deploy [datahub]",
 	Short: "MIMIRO Data Hub configuration deployment CLI",
 	Long:  `MIMIRO Data Hub configuration deployment CLI`,
+	Args:  cobra.MaximumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		silent, _ := cmd.Flags().GetBool("silent")
-		if silent {
-			pterm.DisableOutput()
-		}
-
-		app, err := app.NewApp(cmd, args)
-		utils.HandleError(err)
-
-		err = app.Run()
+		app := newApp(cmd, args)
+		err := app.Run()
 		utils.HandleError(err)
 	},
 }
 
+func newApp(cmd *cobra.Command, args []string) *app.App {
+	silent, _ := cmd.Flags().GetBool("silent")
+	if silent {
+		pterm.DisableOutput()
+	}
+
+	app, err := app.NewApp(cmd, args)
+	utils.HandleError(err)
+	return app
+}
+
+func newConnectedApp(cmd *cobra.Command, args []string) *app.App {
+	app := newApp(cmd, args)
+	err := app.Connect()
+	utils.HandleError(err)
+	return app
+}
+
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute() {
@@ -38,18 +51,32 @@ func Execute() {
 }
 
 func init() {
-	RootCmd.Flags().StringP("datahub", "d", "", "Datahub server URL")
-	RootCmd.Flags().String("token", "", "Signin Bearer token to use against the DataHub")
-	RootCmd.Flags().StringP("path", "p", "", "Root path of the config location")
-	RootCmd.Flags().StringP("output-path", "o", "", "Output path for written config")
-	RootCmd.Flags().StringArrayP("ignorePath", "i", nil, "paths to ignore from deployment")
-	RootCmd.Flags().StringP("env", "e", "", "Variable file to use for substitution")
-	RootCmd.Flags().StringP("log-format", "l", "", "Log format to use when executing mim commands")
-	RootCmd.Flags().Bool("dry-run", true, "If set to true, only test the changes without applying them")
-	RootCmd.Flags().Bool("create-manifest", true, "Should create a manifest if it is missing")
-	RootCmd.Flags().Bool("abort-missing-secret", true, "Should abort if secret is missing")
-	RootCmd.Flags().Bool("token-stdin", false, "If true, expects a Bearer token on StdIn")
-	RootCmd.Flags().Bool("silent", false, "Enable to silence output")
-	RootCmd.Flags().Bool("display-manifest", false, "Enable to output the Manifest")
-	RootCmd.Flags().Bool("json", false, "Enable to make Manifest output json compatible")
+	RootCmd.PersistentFlags().StringP("datahub", "d", "", "Datahub server URL")
+	RootCmd.PersistentFlags().String("token", "", "Signin Bearer token to use against the DataHub")
+	RootCmd.PersistentFlags().StringP("path", "p", "", "Root path of the config location")
+	RootCmd.PersistentFlags().StringP("output-path", "o", "", "Output path for written config")
+	RootCmd.PersistentFlags().StringArrayP("ignorePath", "i", nil, "Gitignore style pattern, relative to the root path, or path of a file or directory to ignore from deployment")
+	RootCmd.PersistentFlags().StringArrayP("env", "e", nil, "Variable file to use for substitution, repeat to merge several files in order")
+	RootCmd.PersistentFlags().StringP("log-format", "l", "", "Log format to use when executing mim commands")
+	RootCmd.PersistentFlags().String("client", "auto", "DataHub client to use, 'http' for the REST API, 'mim' for the mim cli, or 'auto' for the mim cli only when there are typescript transforms")
+	RootCmd.PersistentFlags().Bool("dry-run", true, "If set to true, only test the changes without applying them")
+	RootCmd.PersistentFlags().String("manifest-id", "DatahubConfigManifest", "Id of the manifest owning the deployed configs, use one manifest per repository deploying to the same datahub")
+	RootCmd.PersistentFlags().Duration("lock-timeout", 5*time.Minute, "How long to wait for a deployment holding the manifest lock to finish")
+	RootCmd.PersistentFlags().Duration("lock-ttl", 30*time.Minute, "How long the manifest lock is held before other deployments may break it as stale")
+	RootCmd.PersistentFlags().Bool("create-manifest", true, "Should create a manifest if it is missing")
+	RootCmd.PersistentFlags().Bool("abort-missing-secret", true, "Abort when a template variable or secret can not be resolved, otherwise only warn")
+	RootCmd.PersistentFlags().Bool("rollback-on-failure", false, "If a deployment fails, restore the configs already changed to their previous version")
+	RootCmd.PersistentFlags().String("template-engine", "default", "Template engine for the config files, 'default' or 'go' for go text/template. Files named *.tmpl.json always use 'go'")
+	RootCmd.PersistentFlags().Bool("compress-transforms", false, "Store the javascript transforms in the manifest gzip compressed")
+	RootCmd.PersistentFlags().String("secret-provider", "env", "Provider resolving {{ secret 'path/key' }} references, either 'env', 'file' or 'vault'")
+	RootCmd.PersistentFlags().String("secrets-file", "", "Age encrypted json file with the secrets, used by the file secret provider")
+	RootCmd.PersistentFlags().String("age-identity", "", "Age identity file to decrypt the secrets file with")
+	RootCmd.PersistentFlags().String("vault-addr", "", "Address of the vault used by the vault secret provider, defaults to VAULT_ADDR")
+	RootCmd.PersistentFlags().String("vault-token", "", "Token for the vault secret provider, defaults to VAULT_TOKEN")
+	RootCmd.PersistentFlags().String("vault-mount", "secret", "Mount path of the key/value version 2 engine in the vault")
+	RootCmd.PersistentFlags().Bool("token-stdin", false, "If true, expects a Bearer token on StdIn")
+	RootCmd.PersistentFlags().Bool("silent", false, "Enable to silence output")
+	RootCmd.PersistentFlags().Bool("display-manifest", false, "Enable to output the Manifest")
+	RootCmd.PersistentFlags().Bool("json", false, "Enable to make Manifest output json compatible")
+
 }
@@ -4,26 +4,34 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/datahub"
 	"github.com/mimiro-io/datahub-config-deployment/internal/app/environment"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/secrets"
 	"github.com/mimiro-io/datahub-config-deployment/internal/app/templating"
 	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
 	"github.com/pterm/pterm"
 	"github.com/spf13/cobra"
 	"github.com/tidwall/pretty"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"sort"
 	"strings"
 )
 
 type App struct {
-	Env *environment.Environment
-	T   *templating.Templating
-	M   *ManifestConfig
-	Mim *MimConfig
+	Env     *environment.Environment
+	T       *templating.Templating
+	M       *ManifestConfig
+	Client  datahub.Client
+	Secrets secrets.Provider
+	// restoring is the deployment being rolled back to
+	restoring *deploymentRecord
+	// transforms is the rendered code of the javascript transforms being deployed, by digest
+	transforms map[string][]byte
 }
 
+// NewApp parses the flags shared by all commands. Commands working against the datahub
+// must call Connect, offline commands only need the config path and env file.
 func NewApp(cmd *cobra.Command, args []string) (*App, error) {
 	// lets validate and set up our environment
 	enableJsonOut, _ := cmd.Flags().GetBool("json")
@@ -31,73 +39,187 @@ func NewApp(cmd *cobra.Command, args []string) (*App, error) {
 		pterm.DisableOutput()
 	}
 
-	datahub, _ := cmd.Flags().GetString("datahub")
-	if datahub == "" && len(args) > 0 {
-		datahub = args[0]
+	server, _ := cmd.Flags().GetString("datahub")
+	if server == "" && len(args) > 0 {
+		server = args[0]
 	}
-	if datahub == "" {
-		return nil, errors.New("URL for DataHub is missing")
-	}
-
-	token, _ := cmd.Flags().GetString("token")
-	stdIn, _ := cmd.Flags().GetBool("token-stdin")
-	if token == "" && stdIn { // token is missing, and should be expected from stdin
-		themBytes, err := utils.ReadStdIn()
+	path, _ := cmd.Flags().GetString("path")
+	project := environment.DefaultProject()
+	if path != "" {
+		var err error
+		project, err = environment.LoadProject(path)
 		if err != nil {
 			return nil, err
 		}
-		if themBytes != nil {
-			token = string(themBytes)
+		if err := applyProjectFlags(cmd, project, path); err != nil {
+			return nil, err
 		}
 	}
-	if token == "" {
-		pterm.Warning.Println("No token provided in param or StdIn, assuming no token is needed")
-	}
-
-	path, _ := cmd.Flags().GetString("path")
+	token, _ := cmd.Flags().GetString("token")
+	stdIn, _ := cmd.Flags().GetBool("token-stdin")
 	outputPath, _ := cmd.Flags().GetString("output-path")
 	ignorePath, _ := cmd.Flags().GetStringArray("ignorePath")
-	env, _ := cmd.Flags().GetString("env")
-	err := verifyEnv(path, env)
-	if err != nil {
-		return nil, err
-	}
-
+	envFiles, _ := cmd.Flags().GetStringArray("env")
 	dryRun, _ := cmd.Flags().GetBool("dry-run")
 	manifest, _ := cmd.Flags().GetBool("create-manifest")
 	abort, _ := cmd.Flags().GetBool("abort-missing-secret")
 	enableManifest, _ := cmd.Flags().GetBool("display-manifest")
 	logFormat, _ := cmd.Flags().GetString("log-format")
+	clientBackend, _ := cmd.Flags().GetString("client")
+	rollbackOnFailure, _ := cmd.Flags().GetBool("rollback-on-failure")
+	templateEngine, _ := cmd.Flags().GetString("template-engine")
+	if templateEngine != "default" && templateEngine != "go" {
+		return nil, fmt.Errorf("unknown template engine '%s', expected 'default' or 'go'", templateEngine)
+	}
+	secretProvider, _ := cmd.Flags().GetString("secret-provider")
+	secretsFile, _ := cmd.Flags().GetString("secrets-file")
+	ageIdentity, _ := cmd.Flags().GetString("age-identity")
+	vaultAddr, _ := cmd.Flags().GetString("vault-addr")
+	if vaultAddr == "" {
+		vaultAddr = os.Getenv("VAULT_ADDR")
+	}
+	vaultToken, _ := cmd.Flags().GetString("vault-token")
+	if vaultToken == "" {
+		vaultToken = os.Getenv("VAULT_TOKEN")
+	}
+	vaultMount, _ := cmd.Flags().GetString("vault-mount")
+	compressTransforms, _ := cmd.Flags().GetBool("compress-transforms")
+	lockTimeout, _ := cmd.Flags().GetDuration("lock-timeout")
+	lockTtl, _ := cmd.Flags().GetDuration("lock-ttl")
+	manifestId, _ := cmd.Flags().GetString("manifest-id")
+	if manifestId == "" || manifestId == manifestRegistryId {
+		return nil, fmt.Errorf("invalid manifest id '%s'", manifestId)
+	}
 
 	e := &environment.Environment{
-		MimServer:               datahub,
+		MimServer:               server,
 		Token:                   token,
+		TokenStdIn:              stdIn,
 		RootPath:                path,
 		OutputPath:              outputPath,
 		IgnorePath:              ignorePath,
-		EnvironmentFile:         env,
+		EnvironmentFiles:        envFiles,
 		DryRun:                  dryRun,
 		CreateManifestIfMissing: manifest,
 		AbortOnMissingSecret:    abort,
 		EnableManifest:          enableManifest,
 		EnableJsonOut:           enableJsonOut,
 		LogFormat:               logFormat,
+		ClientBackend:           clientBackend,
+		RollbackOnFailure:       rollbackOnFailure,
+		TemplateEngine:          templateEngine,
+		CompressTransforms:      compressTransforms,
+		SecretProvider:          secretProvider,
+		SecretsFile:             secretsFile,
+		AgeIdentity:             ageIdentity,
+		VaultAddr:               vaultAddr,
+		VaultToken:              vaultToken,
+		VaultMount:              vaultMount,
+		Project:                 project,
+		ManifestId:              manifestId,
+		LockTimeout:             lockTimeout,
+		LockTtl:                 lockTtl,
+	}
+
+	utils.RegisterSecret(e.VaultToken, e.LogFormat)
+	provider, err := secrets.NewProvider(e.SecretProvider, secrets.Options{
+		File:       e.SecretsFile,
+		Identity:   e.AgeIdentity,
+		VaultAddr:  e.VaultAddr,
+		VaultToken: e.VaultToken,
+		VaultMount: e.VaultMount,
+	})
+	if err != nil {
+		return nil, err
 	}
 
 	return &App{
-		Env: e,
-		T:   templating.NewTemplating(),
-		M:   NewManifest(e),
-		Mim: NewMim(e),
+		Env:     e,
+		T:       templating.NewTemplating(),
+		M:       NewManifest(e, nil),
+		Secrets: secrets.WithMasking(provider, e.LogFormat),
 	}, nil
 }
 
+// projectPathFlags are the flags holding paths, in the project file they are relative to the root path
+var projectPathFlags = []string{"env", "output-path", "secrets-file", "age-identity"}
+
+// applyProjectFlags uses the flags of the project file as defaults for the flags that are not given
+func applyProjectFlags(cmd *cobra.Command, project *environment.Project, rootPath string) error {
+	for name, value := range project.Flags {
+		flag := cmd.Flags().Lookup(name)
+		if flag == nil {
+			return fmt.Errorf("unknown flag '%s' in the project file", name)
+		}
+		if flag.Changed {
+			continue
+		}
+		values, isList := value.([]interface{})
+		if !isList {
+			values = []interface{}{value}
+		}
+		for _, v := range values {
+			flagValue := fmt.Sprint(v)
+			for _, pathFlag := range projectPathFlags {
+				if name == pathFlag && !filepath.IsAbs(flagValue) {
+					flagValue = filepath.Join(rootPath, flagValue)
+				}
+			}
+			if err := cmd.Flags().Set(name, flagValue); err != nil {
+				return fmt.Errorf("invalid value for flag '%s' in the project file: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Connect sets up the client for the datahub, and logs in the mim cli if it is used
+func (app *App) Connect() error {
+	if app.Client != nil {
+		return nil
+	}
+	if app.Env.MimServer == "" {
+		return errors.New("URL for DataHub is missing")
+	}
+
+	if app.Env.Token == "" && app.Env.TokenStdIn { // token is missing, and should be expected from stdin
+		themBytes, err := utils.ReadStdIn()
+		if err != nil {
+			return err
+		}
+		if themBytes != nil {
+			app.Env.Token = string(themBytes)
+		}
+	}
+	if app.Env.Token == "" {
+		pterm.Warning.Println("No token provided in param or StdIn, assuming no token is needed")
+	}
+	utils.RegisterSecret(app.Env.Token, app.Env.LogFormat)
+
+	backend := app.Env.Client()
+	if backend == "mim" && app.Env.ClientBackend == "auto" {
+		pterm.Info.Println("Using the mim client, as the transforms directory holds typescript transforms")
+	}
+	client, err := datahub.NewClient(backend, datahub.Options{
+		Server:    app.Env.MimServer,
+		Token:     app.Env.Token,
+		DryRun:    app.Env.DryRun,
+		LogFormat: app.Env.LogFormat,
+	})
+	if err != nil {
+		return err
+	}
+	app.Client = client
+	app.M.Client = client
+	return app.loginMimCli()
+}
+
 // verifyEnv makes sure the config path and the env path is correct
-func verifyEnv(path string, env string) error {
+func verifyEnv(path string, envFiles []string) error {
 	if path == "" {
 		return errors.New("path is missing")
 	}
-	if env == "" {
+	if len(envFiles) == 0 {
 		return errors.New("path to env variables is missing")
 	}
 
@@ -105,75 +227,90 @@ func verifyEnv(path string, env string) error {
 	if err != nil {
 		return err
 	}
-	err = utils.VerifyPath(env)
-	if err != nil {
-		return err
+	for _, env := range envFiles {
+		err = utils.VerifyPath(env)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// Run plans and applies the deployment, with the manifest locked so no other deployment runs at the same time
 func (app *App) Run() error {
-	files, err := app.Env.GetConfigFiles()
+	err := app.Connect()
 	if err != nil {
 		return err
 	}
-
-	variables, err := app.Env.GetEnvironmentVariables()
+	lock, err := app.M.acquireLock()
 	if err != nil {
 		return err
 	}
-
-	err = app.loginMimCli()
-	if err != nil {
-		return err
+	plan, err := app.createPlan()
+	if err == nil && plan != nil {
+		err = app.applyPlan(plan)
 	}
-	return app.doStuff(files, variables)
+	return errors.Join(err, app.M.releaseLock(lock))
 }
 
+// loginMimCli logs in the mim cli when it is used as the DataHub client, the http client needs no login
 func (app *App) loginMimCli() error {
-	args := []string{
-		"mim", "login", "add", "--alias=deploy", fmt.Sprintf("--server=%s", app.Env.MimServer),
+	mim, ok := app.Client.(*datahub.MimClient)
+	if !ok {
+		return nil
+	}
+	err := mim.Login()
+	if err != nil {
+		pterm.Error.Println(err.Error())
 	}
+	return err
+}
 
-	if app.Env.Token != "" {
-		args = append(args, fmt.Sprintf("--type token --token=%s", app.Env.Token))
+// readConfigs verifies the config path and env file, and loads every config file
+func (app *App) readConfigs() (map[string]config, error) {
+	err := verifyEnv(app.Env.RootPath, app.Env.EnvironmentFiles)
+	if err != nil {
+		return nil, err
 	}
-	utils.LogCommand(args, "default", "")
-	cmdMim1 := exec.Command("/bin/bash", "-c", fmt.Sprintf("%s", strings.Join(args, " ")))
-	output, err := cmdMim1.CombinedOutput()
+
+	files, err := app.Env.GetConfigFiles()
 	if err != nil {
-		pterm.Error.Println("Failed to add login alias: ", string(output), err.Error())
-		return err
+		return nil, err
 	}
 
-	cmdMim2 := exec.Command("/bin/bash", "-c", "mim login deploy")
-	output, err = cmdMim2.CombinedOutput()
+	variables, err := app.Env.GetEnvironmentVariables()
 	if err != nil {
-		pterm.Error.Println("Failed to login mim: ", string(output), err.Error())
-		return err
+		return nil, err
 	}
-	return nil
+	return app.loadConfigs(files, variables)
 }
 
-func (app *App) doStuff(files []string, variables map[string]interface{}) error {
+// loadConfigs reads and templates every config file, and returns the deployable configs by id
+func (app *App) loadConfigs(files []string, variables map[string]interface{}) (map[string]config, error) {
 	var fileConfigs map[string]config
 	fileConfigs = make(map[string]config)
 
+	var problems []utils.ErrorDetails
 	for i := 0; i < len(files); i++ {
 		pterm.Info.Printf(" > Processing %s\n", files[i])
-		rawJson, _ := utils.ReadFile(files[i])
-
-		updatedJson, err := app.T.ReplaceVariableLogic(rawJson, app.Env.RootPath)
+		rendered, err := app.renderFile(files[i], variables)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		updatedJson, err = app.T.ReplaceVariables(updatedJson, variables)
+		relPath, err := filepath.Rel(app.Env.RootPath, files[i])
 		if err != nil {
-			return err
+			relPath = files[i]
+		}
+		if unresolved := app.checkPlaceholders(relPath, rendered); len(unresolved) > 0 {
+			problems = append(problems, unresolved...)
+			continue
 		}
-		jsonContent, err := utils.ReadJson(updatedJson)
+		jsonContent, fileProblems, err := checkConfig(relPath, rendered)
 		if err != nil {
-			pterm.Warning.Printf("Failed to parse json into map for file '%s'\n", files[i])
+			return nil, err
+		}
+		if len(fileProblems) > 0 {
+			problems = append(problems, fileProblems...)
 			continue
 		}
 		fileType, exist := jsonContent["type"].(string)
@@ -184,25 +321,39 @@ func (app *App) doStuff(files []string, variables map[string]interface{}) error
 
 			var transformDigest string
 			if hasJSTransform(jsonContent) {
-				transformPath := jsonContent["transform"].(map[string]interface{})["Path"].(string)
-				transformFullPath := filepath.Join(app.Env.RootPath, "transforms", transformPath)
-				transformDigest, err = getTransformDigest(transformFullPath)
-				if err != nil {
-					return err
+				var code []byte
+				if transformPath := transformPath(jsonContent); transformPath == "" {
+					code, err = inlineTransform(jsonContent)
+					if err != nil {
+						return nil, fmt.Errorf("failed to read the transform of '%s': %w", files[i], err)
+					}
+				} else {
+					if err := app.checkTransformClient(transformPath); err != nil {
+						return nil, err
+					}
+					code, err = app.renderTransform(transformPath, variables)
+					if err != nil {
+						return nil, fmt.Errorf("failed to render transform '%s': %w", transformPath, err)
+					}
 				}
+				transformDigest = digestCode(code)
+				if app.transforms == nil {
+					app.transforms = make(map[string][]byte)
+				}
+				app.transforms[transformDigest] = code
 			}
 
 			// Get relative path
 			relPath, err := filepath.Rel(app.Env.RootPath, files[i])
 			if err != nil {
 				pterm.Error.Println("Failed to determine relative path for ", files[i])
-				return err
+				return nil, err
 			}
 
 			// create md5 digest for each file
 			digest, err := createDigest(jsonContent)
 			if err != nil {
-				return err
+				return nil, err
 			}
 			configType := app.Env.GetConfigType(files[i])
 			if configType == "unknown" {
@@ -220,7 +371,14 @@ func (app *App) doStuff(files []string, variables map[string]interface{}) error
 			if !exist {
 				jsonTitle = ""
 			}
+			idKey := "/id"
+			if fileType == "dataset" {
+				idKey = "/datasetName"
+			}
+			line, col := rendered.pointerPosition(idKey)
 			contentInstance := config{
+				Line:            line,
+				Col:             col,
 				Path:            relPath,
 				JsonContent:     jsonContent,
 				Digest:          digest,
@@ -234,41 +392,59 @@ func (app *App) doStuff(files []string, variables map[string]interface{}) error
 		}
 	}
 
-	currentManifest := Manifest{
-		Id:       "DatahubConfigManifest",
-		Manifest: fileConfigs,
+	// nothing is sent to the datahub when a config is invalid
+	for _, problem := range problems {
+		utils.LogError(problem, app.Env.LogFormat)
 	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("config validation failed with %d errors", len(problems))
+	}
+	return fileConfigs, nil
+}
 
-	previousManifest, err := app.M.getManifestFromDatahub()
+// applyPlan executes the operations of the plan and stores its manifest in the datahub
+func (app *App) applyPlan(plan *Plan) error {
+	currentManifest := plan.Manifest
+	transforms, err := currentManifest.transformCode()
 	if err != nil {
-		if app.Env.CreateManifestIfMissing {
-			pterm.Warning.Println("Unable to read manifest from datahub. Assuming first run.")
-			previousManifest = new(Manifest) // To avoid empty pointer in diff
-		} else {
-			return nil
-		}
+		return err
 	}
+	app.transforms = transforms
+	app.printDiffs(currentManifest.Operations)
 
-	operations := diffManifest(previousManifest, currentManifest)
-	currentManifest.Operations = operations
-	err = app.executeOperations(currentManifest)
+	var tx *transaction
+	if app.Env.RollbackOnFailure && !app.Env.DryRun {
+		tx = newTransaction(app.Client)
+	}
+	executed, err := app.executeOperations(currentManifest, tx)
+	if err == nil && !app.Env.DryRun {
+		// a manifest that is not written no longer matches the datahub, so the deployment failed as a whole
+		err = app.storeManifest(currentManifest, tx)
+	}
 	if err != nil {
+		rollback := ""
+		if tx != nil {
+			rollback = "rolled back"
+			if rollbackErr := app.rollbackDeployment(tx); rollbackErr != nil {
+				rollback = "rollback failed"
+				err = errors.Join(err, rollbackErr)
+			}
+		}
+		if !app.Env.DryRun {
+			app.recordDeployment(currentManifest, executed, err, rollback)
+		}
 		return err
 	}
+	if !app.Env.DryRun {
+		app.recordDeployment(currentManifest, executed, nil, "")
+	}
 
-	jsonManifest, err := json.Marshal(currentManifest)
+	// secrets are never stored or printed with the manifest
+	jsonManifest, err := json.Marshal(currentManifest.redacted())
 	if err != nil {
 		panic(err)
 	}
 
-	if !app.Env.DryRun {
-		pterm.Info.Println("Writing manifest to datahub.")
-		err = app.M.writeManifestToDatahub(string(jsonManifest))
-		if err != nil {
-			return err
-		}
-	}
-
 	if app.Env.EnableManifest {
 		if app.Env.EnableJsonOut {
 			fmt.Println(string(jsonManifest))
@@ -289,241 +465,295 @@ func (app *App) doStuff(files []string, variables map[string]interface{}) error
 	return nil
 }
 
-func (app *App) executeOperations(manifest Manifest) error {
+// storeManifest writes the manifest of a deployment to the datahub and registers it. With a transaction,
+// the previous manifest is snapshotted so that it is restored if the deployment is rolled back.
+func (app *App) storeManifest(manifest Manifest, tx *transaction) error {
+	pterm.Info.Println("Writing manifest to datahub.")
+	// the diffs are only for review and are not stored with the manifest
+	storedManifest, err := json.Marshal(manifest.withoutDiffs().redacted())
+	if err != nil {
+		return err
+	}
+	if tx != nil {
+		manifestConfig := config{Type: "content", Id: app.Env.ManifestId}
+		if err := tx.snapshot(operation{Config: manifestConfig, Action: "update"}); err != nil {
+			return err
+		}
+	}
+	if err := app.M.writeManifestToDatahub(string(storedManifest)); err != nil {
+		return err
+	}
+	return app.M.register()
+}
+
+// executeOperations executes the operations in order, and returns how many were executed before one failed.
+// With a transaction, every config is snapshotted before it is changed.
+func (app *App) executeOperations(manifest Manifest, tx *transaction) (int, error) {
 	operations := manifest.Operations
 
 	pterm.Println()
+	var message string
 	if app.Env.DryRun {
-		message := "Dry run enabled. Showing commands that would be executed without dry run enabled."
-		utils.LogPlain(message, app.Env.LogFormat)
-		app.Mim.CmdOutputs = append(app.Mim.CmdOutputs, message)
+		message = "Dry run enabled. Showing commands that would be executed without dry run enabled."
 	} else {
-		message := "The following commands will be written to datahub using the mim cli:"
-		utils.LogPlain(message, app.Env.LogFormat)
-		app.Mim.CmdOutputs = append(app.Mim.CmdOutputs, message)
+		message = "The following commands will be written to datahub:"
 	}
+	utils.LogPlain(message, app.Env.LogFormat)
 
 	if app.Env.OutputPath != "" {
 		if err := os.MkdirAll(filepath.Join(app.Env.OutputPath, "datalayer_configs"), os.ModePerm); err != nil {
 			fmt.Println("Failed to create directory for datalayer configs")
-			return err
+			return 0, err
+		}
+	}
+
+	for i, operation := range operations {
+		if tx != nil {
+			if err := tx.snapshot(operation); err != nil {
+				pterm.Error.Println(err.Error())
+				return i, err
+			}
+		}
+		if err := app.executeOperation(operation); err != nil {
+			return i, err
 		}
 	}
+	if app.Env.LogFormat == "github" {
+		cmdOutputs := append([]string{message}, app.Client.CommandLog()...)
+		pterm.DefaultBasicText.Println("::set-output name=dry_run_output::", utils.Redact(strings.Join(cmdOutputs, "%0A* ")))
+	}
+	return len(operations), nil
+}
 
-	for _, operation := range operations {
-		tmpFileName := operation.Config.Id + ".json"
-		if operation.Config.Title != "" {
-			tmpFileName = operation.Config.Title + ".json"
+func (app *App) executeOperation(operation operation) error {
+	switch operation.Config.Type {
+	case "content":
+		return app.executeContentOperation(operation)
+	case "job":
+		err := app.executeJobOperation(operation)
+		if err == nil && operation.Action != "delete" {
+			err = app.ensureSinkDataset(operation)
 		}
-		tmpFilePath := filepath.Join(app.Env.OutputPath, tmpFileName)
-		jsonContent, err := json.Marshal(operation.Config.JsonContent)
-		if operation.Config.Type == "dataset" {
-			jsonContent, err = json.Marshal(operation.Config.JsonContent["entities"])
+		return err
+	case "dataset":
+		return app.executeDatasetOperation(operation)
+	}
+	return nil
+}
+
+// configFileName is the name used when a rendered config is written to the output path
+func configFileName(c config) string {
+	if c.Title != "" {
+		return c.Title + ".json"
+	}
+	return c.Id + ".json"
+}
+
+func (app *App) logOperationError(operation operation, message string, err error) {
+	errBody := utils.ErrorDetails{
+		File:    operation.ConfigPath,
+		Message: fmt.Sprintf("%s: %s\n", message, err.Error()),
+	}
+	if operation.Action != "delete" {
+		// a deleted config no longer has a file to point at
+		errBody.Line = operation.Config.Line
+		errBody.Col = operation.Config.Col
+	}
+	utils.LogError(errBody, app.Env.LogFormat)
+}
+
+func (app *App) executeContentOperation(operation operation) error {
+	if operation.Action == "delete" {
+		err := app.Client.DeleteContent(operation.Config.Id)
+		if err != nil {
+			app.logOperationError(operation, fmt.Sprintf("Failed to delete content '%s' from datahub", operation.Config.Id), err)
 		}
+		//TODO: Fix deletion support for the datalayer configs in the output path
+		return err
+	}
 
-		if operation.Action != "delete" {
-			if err != nil {
-				fmt.Println("Failed to marshal config for " + operation.Config.Id + " to json before writing to temp file.")
-				return err
-			}
-			d1 := jsonContent
-			err = os.WriteFile(tmpFilePath, d1, 0644)
-			if err != nil {
-				fmt.Println("Failed to write config to temp file")
-				return err
-			}
+	jsonContent, err := json.Marshal(operation.Config.JsonContent)
+	if err != nil {
+		fmt.Println("Failed to marshal config for " + operation.Config.Id + " to json.")
+		return err
+	}
+	err = app.Client.AddContent(jsonContent)
+	if err != nil {
+		app.logOperationError(operation, fmt.Sprintf("Failed to write content '%s' to datahub", operation.Config.Id), err)
+		return err
+	}
+
+	if app.Env.OutputPath != "" {
+		// the written configs are not as protected as the datahub, so they hold no secrets
+		redactedContent, err := json.Marshal(redactContent(operation.Config.JsonContent))
+		if err != nil {
+			return err
 		}
+		err = os.WriteFile(filepath.Join(app.Env.OutputPath, "datalayer_configs", configFileName(operation.Config)), redactedContent, 0644)
+		if err != nil {
+			app.logOperationError(operation, "Failed to write config file to config directory", err)
+			return err
+		}
+	}
+	return nil
+}
 
-		if operation.Config.Type == "content" {
-			var output []byte
-			var err, err2 error
-			if operation.Action == "delete" {
-				output, err = app.Mim.MimContentDelete(operation.Config.Id)
-				//err2 = os.WriteFile(filepath.Join(app.Env.OutputPath, "datalayer_configs", "deleted", tmpFileName), []byte(""), 0777) TODO: Fix deletion support
-			} else {
-				output, err = app.Mim.MimContentAdd(tmpFilePath)
-				if app.Env.OutputPath != "" {
-					err2 = os.WriteFile(filepath.Join(app.Env.OutputPath, "datalayer_configs", tmpFileName), jsonContent, 0777)
-				}
-			}
-			if err != nil {
-				errBody := utils.ErrorDetails{
-					File:    operation.ConfigPath,
-					Line:    0,
-					Col:     0,
-					Message: fmt.Sprintf("Failed to write content '%s' to datahub: %s\n", operation.Config.Id, string(output)),
-				}
-				utils.LogError(errBody, app.Env.LogFormat)
-				return err
-			}
+func (app *App) executeJobOperation(operation operation) error {
+	if operation.Action == "delete" {
+		err := app.Client.DeleteJob(operation.Config.Id)
+		if err != nil {
+			app.logOperationError(operation, fmt.Sprintf("Failed to delete job '%s' from datahub", operation.Config.Id), err)
+		}
+		return err
+	}
 
-			if err2 != nil {
-				errBody := utils.ErrorDetails{
-					File:    operation.ConfigPath,
-					Line:    0,
-					Col:     0,
-					Message: fmt.Sprintf("Failed to write config file to config directory"),
-				}
-				utils.LogError(errBody, app.Env.LogFormat)
-				return err2
-			}
+	// Will handle both add and update
+	jsonContent, err := json.Marshal(operation.Config.JsonContent)
+	if err != nil {
+		fmt.Println("Failed to marshal config for " + operation.Config.Id + " to json.")
+		return err
+	}
+	var transform *datahub.Transform
+	if operation.HasJSTransform {
+		transformPath, code, err := app.readTransform(operation.Config)
+		if err != nil {
+			app.logOperationError(operation, fmt.Sprintf("Failed to read transform '%s'", transformPath), err)
+			return err
+		}
+		transform = &datahub.Transform{Name: transformPath, Code: code}
+	}
+	err = app.Client.AddJob(jsonContent, transform)
+	if err != nil {
+		app.logOperationError(operation, fmt.Sprintf("Failed to write job to datahub: \n%s\n", string(jsonContent)), err)
+	}
+	return err
+}
 
-		} else if operation.Config.Type == "job" {
-			var output []byte
-			var err error
-			if operation.Action == "delete" {
-				output, err = app.Mim.MimJobDelete(operation.Config.Id)
-			} else {
-				// Will handle both add and update
-				transformFullPath := ""
-				if operation.HasJSTransform {
-					transformPath := operation.Config.JsonContent["transform"].(map[string]interface{})["Path"].(string)
-					transformFullPath = filepath.Join(app.Env.RootPath, "transforms", transformPath)
-				}
-				output, err = app.Mim.MimJobAdd(tmpFilePath, transformFullPath)
-			}
-			if err != nil {
-				errBody := utils.ErrorDetails{
-					File:    operation.ConfigPath,
-					Line:    0,
-					Col:     0,
-					Message: fmt.Sprintf("Failed to write job to datahub: \n%s\n%s\n", string(output), string(jsonContent)),
-				}
-				utils.LogError(errBody, app.Env.LogFormat)
-				return err
-			}
+func (app *App) executeDatasetOperation(operation operation) error {
+	if operation.Action == "delete" {
+		err := app.Client.DeleteDataset(operation.Config.Id)
+		if err != nil {
+			app.logOperationError(operation, fmt.Sprintf("Failed to delete dataset '%s'", operation.Config.Id), err)
+		}
+		return err
+	}
 
-		} else if operation.Config.Type == "dataset" {
-			if operation.Action == "delete" {
-				err := app.Mim.MimDatasetDelete(operation.Config.Id)
-				if err != nil {
-					return err
-				}
-			} else {
-				ns, exist := operation.Config.JsonContent["publicNamespaces"]
-				var publicNamespace []string
-				if exist && len(ns.([]interface{})) > 0 {
-					for _, value := range ns.([]interface{}) {
-						publicNamespace = append(publicNamespace, value.(string))
-					}
-				}
+	jsonContent, err := json.Marshal(operation.Config.JsonContent["entities"])
+	if err != nil {
+		fmt.Println("Failed to marshal entities for " + operation.Config.Id + " to json.")
+		return err
+	}
+	ns, exist := operation.Config.JsonContent["publicNamespaces"]
+	var publicNamespace []string
+	if exist && len(ns.([]interface{})) > 0 {
+		for _, value := range ns.([]interface{}) {
+			publicNamespace = append(publicNamespace, value.(string))
+		}
+	}
 
-				// Check if dataset already exist
-				_, err := app.Mim.MimDatasetGet(operation.Config.Id)
-				if err == nil {
-					// Already exist, we need to delete before creating again
-					err := app.Mim.MimDatasetDelete(operation.Config.Id)
-					if err != nil {
-						return err
-					}
-				}
-				output, err := app.Mim.MimDatasetCreate(operation.Config.Id, publicNamespace)
-				if err != nil {
-					if !strings.Contains(string(output), "Dataset already exist") {
-						return err
-					}
-				}
+	// Check if dataset already exist
+	_, err = app.Client.GetDataset(operation.Config.Id)
+	if err == nil {
+		// Already exist, we need to delete before creating again
+		err := app.Client.DeleteDataset(operation.Config.Id)
+		if err != nil {
+			app.logOperationError(operation, fmt.Sprintf("Failed to delete dataset '%s'", operation.Config.Id), err)
+			return err
+		}
+	}
+	err = app.Client.CreateDataset(operation.Config.Id, publicNamespace)
+	if err != nil && !datahub.IsConflict(err) {
+		app.logOperationError(operation, fmt.Sprintf("Failed to create dataset '%s'", operation.Config.Id), err)
+		return err
+	}
 
-				output, err = app.Mim.MimDatasetStore(operation.Config.Id, jsonContent)
-				if err != nil {
-					if strings.Contains(string(output), "dataset does not exist") {
-						// Create missing dataset and try again
-						_, err := app.Mim.MimDatasetCreate(operation.Config.Id, publicNamespace)
-						if err != nil {
-							return err
-						}
-						_, err = app.Mim.MimDatasetStore(operation.Config.Id, jsonContent)
-						if err != nil {
-							return err
-						}
-					} else {
-						return err
-					}
-				}
-			}
+	err = app.Client.StoreEntities(operation.Config.Id, jsonContent)
+	if datahub.IsNotFound(err) {
+		// Create missing dataset and try again
+		err = app.Client.CreateDataset(operation.Config.Id, publicNamespace)
+		if err == nil {
+			err = app.Client.StoreEntities(operation.Config.Id, jsonContent)
 		}
-		if operation.Action != "delete" {
-			// Remove temp file
-			err := os.Remove(tmpFilePath)
-			if err != nil {
-				pterm.Error.Println("Failed to remove tmp file for ", operation.Config.Id)
-				return err
-			}
+	}
+	if err != nil {
+		app.logOperationError(operation, fmt.Sprintf("Failed to store entities in dataset '%s'", operation.Config.Id), err)
+	}
+	return err
+}
+
+// ensureSinkDataset creates the sink dataset of a job if it is missing, and updates its public namespaces
+// if they differ from the job config
+func (app *App) ensureSinkDataset(operation operation) error {
+	// Check if job has dataset sink
+	sinkDataset := determineSinkDataset(operation.Config.JsonContent)
+	if sinkDataset == "" {
+		return nil
+	}
+	// Check if dataset exist already
+	datasetResponse, err := app.Client.GetDataset(sinkDataset)
+	publicNamespaces := getPublicNamespaces(operation.Config.JsonContent)
+	if err != nil {
+		// Failed to get dataset. Proceeding to create on datahub.
+		pterm.Warning.Printf("Required dataset not available on datahub. Creating dataset '%s' for job '%s'.\n", sinkDataset, operation.Config.Title)
+		err := app.Client.CreateDataset(sinkDataset, publicNamespaces)
+		if err != nil {
+			app.logOperationError(operation, fmt.Sprintf("Failed to create dataset '%s'", sinkDataset), err)
 		}
-		// Check if required dataset need to be created
-		if operation.Config.Type == "job" && operation.Action != "delete" {
-			// Check if job has dataset sink
-			sinkDataset := determineSinkDataset(operation.Config.JsonContent)
-			if sinkDataset != "" {
-				// Check if dataset exist already
-				datasetResponse, err := app.Mim.MimDatasetGet(sinkDataset)
-				publicNamespaces := getPublicNamespaces(operation.Config.JsonContent)
-				if err != nil {
-					// Failed to get dataset. Proceeding to create on datahub.
-					pterm.Warning.Printf("Required dataset not available on datahub. Creating dataset '%s' for job '%s'.\n", sinkDataset, operation.Config.Title)
-
-					_, err := app.Mim.MimDatasetCreate(sinkDataset, publicNamespaces)
-					if err != nil {
-						return err
-					}
-				} else {
-					// Dataset already exist, but we need to check if the public namespaces are defined
-					remoteNamespaces := datasetResponse.PublicNamespaces
-					sort.Strings(publicNamespaces)
-					sort.Strings(remoteNamespaces)
-					needUpdate := false
-					if len(publicNamespaces) != len(remoteNamespaces) {
-						needUpdate = true
-					} else {
-						for i := range publicNamespaces {
-							if publicNamespaces[i] != remoteNamespaces[i] {
-								needUpdate = true
-							}
-						}
-					}
-					if needUpdate {
-						pterm.Warning.Printf("Public namespaces does not match config for dataset %s. Updating core dataset\n", sinkDataset)
-
-						coreDatasets, err := app.Mim.MimDatasetEntities("core.Dataset")
-						if err != nil {
-							return err
-						}
-						var coreEntity Entity
-						var context Entity
-						for _, entity := range coreDatasets {
-							id := entity.Id[4:]
-							if id == sinkDataset {
-								coreEntity = entity
-							}
-							if entity.Id == "@context" {
-								context = entity
-							}
-						}
-						if coreEntity.Id == "" {
-							pterm.Error.Printf("Failed to find dataset '%s' in core dataset", sinkDataset)
-							break
-						}
-						props := coreEntity.Props
-						if props == nil {
-							props = make(map[string]interface{})
-						}
-						props["ns0:publicNamespaces"] = publicNamespaces
-						coreEntity.Props = props
-						payload := []Entity{context, coreEntity}
-						payloadJsonBytes, err := json.Marshal(payload)
-
-						_, err = app.Mim.MimDatasetStore("core.Dataset", payloadJsonBytes)
-						if err != nil {
-							pterm.Error.Println("Failed to update public namespaces in core dataset for dataset ", sinkDataset)
-						}
-					}
-				}
+		return err
+	}
+
+	// Dataset already exist, but we need to check if the public namespaces are defined
+	remoteNamespaces := datasetResponse.PublicNamespaces
+	sort.Strings(publicNamespaces)
+	sort.Strings(remoteNamespaces)
+	needUpdate := false
+	if len(publicNamespaces) != len(remoteNamespaces) {
+		needUpdate = true
+	} else {
+		for i := range publicNamespaces {
+			if publicNamespaces[i] != remoteNamespaces[i] {
+				needUpdate = true
 			}
 		}
+	}
+	if !needUpdate {
+		return nil
+	}
+	pterm.Warning.Printf("Public namespaces does not match config for dataset %s. Updating core dataset\n", sinkDataset)
 
+	coreDatasets, err := app.Client.GetEntities("core.Dataset")
+	if err != nil {
+		pterm.Error.Println("Failed to get dataset entities from datahub: ", err.Error())
+		return err
 	}
-	if app.Env.LogFormat == "github" {
-		pterm.DefaultBasicText.Println("::set-output name=dry_run_output::", strings.Join(app.Mim.CmdOutputs, "%0A* "))
+	var coreEntity datahub.Entity
+	var context datahub.Entity
+	for _, entity := range coreDatasets {
+		if entity.Id == "@context" {
+			context = entity
+		} else if len(entity.Id) > 4 && entity.Id[4:] == sinkDataset {
+			coreEntity = entity
+		}
+	}
+	if coreEntity.Id == "" {
+		pterm.Error.Printf("Failed to find dataset '%s' in core dataset\n", sinkDataset)
+		return nil
+	}
+	props := coreEntity.Props
+	if props == nil {
+		props = make(map[string]interface{})
+	}
+	props["ns0:publicNamespaces"] = publicNamespaces
+	coreEntity.Props = props
+	payload := []datahub.Entity{context, coreEntity}
+	payloadJsonBytes, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	err = app.Client.StoreEntities("core.Dataset", payloadJsonBytes)
+	if err != nil {
+		pterm.Error.Println("Failed to update public namespaces in core dataset for dataset ", sinkDataset)
 	}
 	return nil
 }
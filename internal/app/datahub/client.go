@@ -0,0 +1,126 @@
+package datahub
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
+	"net/http"
+	"strings"
+)
+
+// Client is the set of DataHub operations needed to deploy a configuration.
+// Write operations are only logged when the client is created in dry run mode.
+type Client interface {
+	GetJob(id string) ([]byte, error)
+	AddJob(job []byte, transform *Transform) error
+	DeleteJob(id string) error
+	GetContent(id string) ([]byte, error)
+	AddContent(content []byte) error
+	DeleteContent(id string) error
+	GetDataset(name string) (*Dataset, error)
+	CreateDataset(name string, publicNamespaces []string) error
+	DeleteDataset(name string) error
+	GetEntities(name string) ([]Entity, error)
+	StoreEntities(name string, entities []byte) error
+	// CommandLog returns every write operation the client has executed or, in dry run mode, skipped
+	CommandLog() []string
+}
+
+// Transform is the source of a javascript or typescript transform, the name is used to detect the language
+type Transform struct {
+	Name string
+	Code []byte
+}
+
+type Entity struct {
+	Id         string                 `json:"id"`
+	Recorded   int64                  `json:"recorded,omitempty"`
+	Deleted    bool                   `json:"deleted,omitempty"`
+	Refs       map[string]interface{} `json:"refs,omitempty"`
+	Props      map[string]interface{} `json:"props,omitempty"`
+	Namespaces map[string]interface{} `json:"namespaces,omitempty"`
+	// Token is only set on the @continuation that ends a page of entities
+	Token string `json:"token,omitempty"`
+}
+
+// entityPageSize is the number of entities read from a dataset in one request
+const entityPageSize = 40000
+
+type Dataset struct {
+	Items            int      `json:"items"`
+	Name             string   `json:"name"`
+	PublicNamespaces []string `json:"publicNamespaces"`
+}
+
+type Options struct {
+	Server    string
+	Token     string
+	DryRun    bool
+	LogFormat string
+}
+
+// Error is returned for every request the DataHub rejects. StatusCode is 0 when the
+// mim client fails with an output that can not be translated to a status.
+type Error struct {
+	StatusCode int
+	Body       string
+	Operation  string
+}
+
+func (e *Error) Error() string {
+	msg := e.Operation + " failed"
+	if e.StatusCode != 0 {
+		msg = fmt.Sprintf("%s with status %d", msg, e.StatusCode)
+	}
+	if body := strings.TrimSpace(e.Body); body != "" {
+		msg = msg + ": " + body
+	}
+	return msg
+}
+
+// IsNotFound reports whether err is a DataHub error for a missing job, content or dataset
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsConflict reports whether err is a DataHub error for something that already exists
+func IsConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
+
+func hasStatus(err error, status int) bool {
+	var dhErr *Error
+	if errors.As(err, &dhErr) {
+		return dhErr.StatusCode == status
+	}
+	return false
+}
+
+// NewClient returns the client for the named backend, either "http" or "mim"
+func NewClient(backend string, opts Options) (Client, error) {
+	switch backend {
+	case "", "http":
+		return NewHttpClient(opts), nil
+	case "mim":
+		return NewMimClient(opts), nil
+	default:
+		return nil, fmt.Errorf("unknown datahub client '%s', expected 'auto', 'http' or 'mim'", backend)
+	}
+}
+
+// recorder keeps track of write operations and decides if they should be executed
+type recorder struct {
+	dryRun    bool
+	logFormat string
+	commands  []string
+}
+
+func (r *recorder) record(args []string, comment string) bool {
+	r.commands = append(r.commands, strings.Join(args, " "))
+	utils.LogCommand(args, r.logFormat, comment)
+	return !r.dryRun
+}
+
+func (r *recorder) CommandLog() []string {
+	return r.commands
+}
@@ -0,0 +1,229 @@
+package datahub
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// HttpClient talks directly to the DataHub REST API
+type HttpClient struct {
+	recorder
+	server string
+	token  string
+	client *http.Client
+}
+
+func NewHttpClient(opts Options) *HttpClient {
+	return &HttpClient{
+		recorder: recorder{dryRun: opts.DryRun, logFormat: opts.LogFormat},
+		server:   strings.TrimSuffix(opts.Server, "/"),
+		token:    strings.TrimSpace(opts.Token),
+		client:   &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+func (c *HttpClient) GetJob(id string) ([]byte, error) {
+	return c.do(http.MethodGet, "/jobs/"+url.PathEscape(id), nil)
+}
+
+func (c *HttpClient) AddJob(job []byte, transform *Transform) error {
+	if transform != nil {
+		if strings.HasSuffix(transform.Name, ".ts") {
+			return fmt.Errorf("typescript transform '%s' must be compiled by the mim client, use --client=mim", transform.Name)
+		}
+		var jobContent map[string]interface{}
+		if err := json.Unmarshal(job, &jobContent); err != nil {
+			return err
+		}
+		// the other transform properties, like Parallelism, are kept
+		jobTransform := map[string]interface{}{}
+		if existing, ok := jobContent["transform"].(map[string]interface{}); ok {
+			for key, value := range existing {
+				jobTransform[key] = value
+			}
+		}
+		delete(jobTransform, "Path")
+		jobTransform["Type"] = "JavascriptTransform"
+		jobTransform["Code"] = base64.StdEncoding.EncodeToString(transform.Code)
+		jobContent["transform"] = jobTransform
+		var err error
+		job, err = json.Marshal(jobContent)
+		if err != nil {
+			return err
+		}
+	}
+	if !c.record([]string{"POST", c.server + "/jobs"}, payloadId(job)) {
+		return nil
+	}
+	_, err := c.do(http.MethodPost, "/jobs", job)
+	return err
+}
+
+func (c *HttpClient) DeleteJob(id string) error {
+	path := "/jobs/" + url.PathEscape(id)
+	if !c.record([]string{"DELETE", c.server + path}, "") {
+		return nil
+	}
+	_, err := c.do(http.MethodDelete, path, nil)
+	return err
+}
+
+func (c *HttpClient) GetContent(id string) ([]byte, error) {
+	return c.do(http.MethodGet, "/content/"+url.PathEscape(id), nil)
+}
+
+func (c *HttpClient) AddContent(content []byte) error {
+	if !c.record([]string{"POST", c.server + "/content"}, payloadId(content)) {
+		return nil
+	}
+	_, err := c.do(http.MethodPost, "/content", content)
+	return err
+}
+
+func (c *HttpClient) DeleteContent(id string) error {
+	path := "/content/" + url.PathEscape(id)
+	if !c.record([]string{"DELETE", c.server + path}, "") {
+		return nil
+	}
+	_, err := c.do(http.MethodDelete, path, nil)
+	return err
+}
+
+func (c *HttpClient) GetDataset(name string) (*Dataset, error) {
+	body, err := c.do(http.MethodGet, "/datasets/"+url.PathEscape(name), nil)
+	if err != nil {
+		return nil, err
+	}
+	dataset := &Dataset{}
+	if err := json.Unmarshal(body, dataset); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal dataset response: %w", err)
+	}
+	return dataset, nil
+}
+
+func (c *HttpClient) CreateDataset(name string, publicNamespaces []string) error {
+	path := "/datasets/" + url.PathEscape(name)
+	if !c.record([]string{"POST", c.server + path}, strings.Join(publicNamespaces, ", ")) {
+		return nil
+	}
+	var payload []byte
+	if len(publicNamespaces) > 0 {
+		var err error
+		payload, err = json.Marshal(map[string]interface{}{"publicNamespaces": publicNamespaces})
+		if err != nil {
+			return err
+		}
+	}
+	_, err := c.do(http.MethodPost, path, payload)
+	return err
+}
+
+func (c *HttpClient) DeleteDataset(name string) error {
+	path := "/datasets/" + url.PathEscape(name)
+	if !c.record([]string{"DELETE", c.server + path}, "") {
+		return nil
+	}
+	_, err := c.do(http.MethodDelete, path, nil)
+	return err
+}
+
+// GetEntities reads every entity of the dataset, following the continuation token page by page.
+// The @context of the first page is kept in front of the entities.
+func (c *HttpClient) GetEntities(name string) ([]Entity, error) {
+	var entities []Entity
+	path := "/datasets/" + url.PathEscape(name) + "/entities?limit=" + fmt.Sprint(entityPageSize)
+	for {
+		body, err := c.do(http.MethodGet, path, nil)
+		if err != nil {
+			return nil, err
+		}
+		var page []Entity
+		if err := json.Unmarshal(body, &page); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal dataset entities response: %w", err)
+		}
+		// the last element is a continuation token and not an entity
+		token := ""
+		if len(page) > 0 && page[len(page)-1].Id == "@continuation" {
+			token = page[len(page)-1].Token
+			page = page[:len(page)-1]
+		}
+		read := 0
+		for _, entity := range page {
+			if entity.Id == "@context" && len(entities) > 0 {
+				continue
+			}
+			if entity.Id != "@context" {
+				read++
+			}
+			entities = append(entities, entity)
+		}
+		if token == "" || read == 0 {
+			return entities, nil
+		}
+		path = "/datasets/" + url.PathEscape(name) + "/entities?limit=" + fmt.Sprint(entityPageSize) + "&from=" + url.QueryEscape(token)
+	}
+}
+
+func (c *HttpClient) StoreEntities(name string, entities []byte) error {
+	path := "/datasets/" + url.PathEscape(name) + "/entities"
+	if !c.record([]string{"POST", c.server + path}, "") {
+		return nil
+	}
+	_, err := c.do(http.MethodPost, path, entities)
+	return err
+}
+
+func (c *HttpClient) do(method string, path string, payload []byte) ([]byte, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, c.server+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return body, &Error{
+			StatusCode: res.StatusCode,
+			Body:       string(body),
+			Operation:  method + " " + path,
+		}
+	}
+	return body, nil
+}
+
+// payloadId extracts the id of a job or content payload for logging
+func payloadId(payload []byte) string {
+	var content struct {
+		Id string `json:"id"`
+	}
+	if err := json.Unmarshal(payload, &content); err != nil {
+		return ""
+	}
+	return content.Id
+}
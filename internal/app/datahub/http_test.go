@@ -0,0 +1,57 @@
+package datahub
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestHttpClientAddJobTransform(t *testing.T) {
+	code := []byte("function transform_entities(entities) { return entities; }")
+	tests := []struct {
+		name      string
+		transform map[string]interface{}
+		want      map[string]interface{}
+	}{
+		{
+			name:      "path replaced by code",
+			transform: map[string]interface{}{"Type": "JavascriptTransform", "Path": "t.js"},
+			want:      map[string]interface{}{"Type": "JavascriptTransform", "Code": base64.StdEncoding.EncodeToString(code)},
+		},
+		{
+			name:      "parallelism kept",
+			transform: map[string]interface{}{"Type": "JavascriptTransform", "Path": "t.js", "Parallelism": 4.0},
+			want:      map[string]interface{}{"Type": "JavascriptTransform", "Code": base64.StdEncoding.EncodeToString(code), "Parallelism": 4.0},
+		},
+		{
+			name:      "inline code replaced",
+			transform: map[string]interface{}{"Type": "JavascriptTransform", "Parallelism": 2.0},
+			want:      map[string]interface{}{"Type": "JavascriptTransform", "Code": base64.StdEncoding.EncodeToString(code), "Parallelism": 2.0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var posted map[string]interface{}
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				if err := json.Unmarshal(body, &posted); err != nil {
+					t.Errorf("invalid job posted: %v", err)
+				}
+			}))
+			defer server.Close()
+
+			job, _ := json.Marshal(map[string]interface{}{"id": "job1", "transform": tt.transform})
+			client := NewHttpClient(Options{Server: server.URL})
+			if err := client.AddJob(job, &Transform{Name: "t.js", Code: code}); err != nil {
+				t.Fatal(err)
+			}
+			if got := posted["transform"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("posted transform = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+package datahub
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// MimClient executes every operation through the mim cli, which must be installed and on the PATH
+type MimClient struct {
+	recorder
+	server string
+	token  string
+}
+
+func NewMimClient(opts Options) *MimClient {
+	return &MimClient{
+		recorder: recorder{dryRun: opts.DryRun, logFormat: opts.LogFormat},
+		server:   opts.Server,
+		token:    strings.TrimSpace(opts.Token),
+	}
+}
+
+// Login adds and activates the "deploy" login alias used by all later mim commands
+func (m *MimClient) Login() error {
+	args := []string{
+		"mim", "login", "add", "--alias=deploy", fmt.Sprintf("--server=%s", m.server),
+	}
+	if m.token != "" {
+		args = append(args, fmt.Sprintf("--type token --token=%s", m.token))
+	}
+	utils.LogCommand(args, "default", "")
+	if _, err := m.mimCommand(args); err != nil {
+		return fmt.Errorf("failed to add login alias: %w", err)
+	}
+	if _, err := m.mimCommand([]string{"mim", "login", "deploy"}); err != nil {
+		return fmt.Errorf("failed to login mim: %w", err)
+	}
+	return nil
+}
+
+func (m *MimClient) GetJob(id string) ([]byte, error) {
+	return m.mimCommand([]string{"mim", "job", "get", id, "--json"})
+}
+
+func (m *MimClient) AddJob(job []byte, transform *Transform) error {
+	jobFile, err := writeTempFile("job-*.json", job)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(jobFile)
+
+	cmd := []string{"mim", "job", "add", "-f", jobFile}
+	if transform != nil {
+		transformFile, err := writeTempFile("transform-*"+filepath.Ext(transform.Name), transform.Code)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(transformFile)
+		cmd = append(cmd, "-t", transformFile)
+	}
+	_, err = m.run(cmd, payloadId(job))
+	return err
+}
+
+func (m *MimClient) DeleteJob(id string) error {
+	_, err := m.run([]string{"mim", "job", "delete", id, "-C=false"}, "")
+	return err
+}
+
+func (m *MimClient) GetContent(id string) ([]byte, error) {
+	return m.mimCommand([]string{"mim", "content", "show", id, "--json"})
+}
+
+func (m *MimClient) AddContent(content []byte) error {
+	contentFile, err := writeTempFile("content-*.json", content)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(contentFile)
+
+	_, err = m.run([]string{"mim", "content", "add", "-f", contentFile}, payloadId(content))
+	return err
+}
+
+func (m *MimClient) DeleteContent(id string) error {
+	_, err := m.run([]string{"mim", "content", "delete", id, "-C=false"}, "")
+	return err
+}
+
+func (m *MimClient) GetDataset(name string) (*Dataset, error) {
+	output, err := m.mimCommand([]string{"mim", "dataset", "get", name, "--json"})
+	if err != nil {
+		return nil, err
+	}
+	dataset := &Dataset{}
+	if err := json.Unmarshal(output, dataset); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal dataset response: %w", err)
+	}
+	return dataset, nil
+}
+
+func (m *MimClient) CreateDataset(name string, publicNamespaces []string) error {
+	cmd := []string{"mim", "dataset", "create", name}
+	if len(publicNamespaces) > 0 {
+		cmd = append(cmd, "--publicNamespaces", fmt.Sprintf("'%s'", strings.Join(publicNamespaces, "','")))
+	}
+	_, err := m.run(cmd, "")
+	return err
+}
+
+func (m *MimClient) DeleteDataset(name string) error {
+	_, err := m.run([]string{"mim", "dataset", "delete", name, "-C=false"}, "")
+	return err
+}
+
+func (m *MimClient) GetEntities(name string) ([]Entity, error) {
+	output, err := m.mimCommand([]string{"mim", "dataset", "entities", name, "--json", fmt.Sprintf("--limit=%d", entityPageSize)})
+	if err != nil {
+		return nil, err
+	}
+	var entities []Entity
+	if err := json.Unmarshal(output, &entities); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal dataset entities response: %w", err)
+	}
+	// the mim cli reads a single page, so a full page may be missing entities
+	if len(entities) > 0 && entities[len(entities)-1].Id == "@continuation" {
+		entities = entities[:len(entities)-1]
+	}
+	count := 0
+	for _, entity := range entities {
+		if entity.Id != "@context" {
+			count++
+		}
+	}
+	if count >= entityPageSize {
+		return nil, fmt.Errorf("dataset '%s' has %d entities or more, which the mim client can not read, use --client=http", name, entityPageSize)
+	}
+	return entities, nil
+}
+
+func (m *MimClient) StoreEntities(name string, entities []byte) error {
+	entityFile, err := writeTempFile("entities-*.json", entities)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(entityFile)
+
+	_, err = m.run([]string{"mim", "dataset", "store", name, "-f", entityFile}, "")
+	return err
+}
+
+// run records and executes a write command, in dry run mode the command is only recorded
+func (m *MimClient) run(cmd []string, comment string) ([]byte, error) {
+	if !m.record(cmd, comment) {
+		return nil, nil
+	}
+	return m.mimCommand(cmd)
+}
+
+func (m *MimClient) mimCommand(cmd []string) ([]byte, error) {
+	cmdExec := exec.Command("/bin/bash", "-c", strings.Join(cmd, " "))
+	output, err := cmdExec.CombinedOutput()
+	if err != nil {
+		return output, &Error{
+			StatusCode: mimStatus(string(output)),
+			Body:       string(output),
+			Operation:  strings.Join(cmd[:3], " "),
+		}
+	}
+	return output, nil
+}
+
+// mimStatus translates the known mim cli error messages to the status code the DataHub responded with
+func mimStatus(output string) int {
+	lower := strings.ToLower(output)
+	switch {
+	case strings.Contains(lower, "already exist"):
+		return http.StatusConflict
+	case strings.Contains(lower, "does not exist"), strings.Contains(lower, "not found"):
+		return http.StatusNotFound
+	case strings.Contains(lower, "unauthorized"), strings.Contains(lower, "401"):
+		return http.StatusUnauthorized
+	default:
+		return 0
+	}
+}
+
+func writeTempFile(pattern string, content []byte) (string, error) {
+	file, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := file.Write(content); err != nil {
+		return "", err
+	}
+	return file.Name(), nil
+}
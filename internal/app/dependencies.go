@@ -0,0 +1,226 @@
+package app
+
+import (
+	"github.com/pterm/pterm"
+	"sort"
+	"strings"
+)
+
+// typeRank decides the order of independent operations, so that plans are stable between runs
+var typeRank = map[string]int{"dataset": 0, "content": 1, "job": 2}
+
+func nodeKey(c config) string {
+	return c.Type + ":" + c.Id
+}
+
+// orderOperations sorts the operations so that adds and updates of dependencies are executed before
+// the configs depending on them, followed by the deletes with the dependants deleted first.
+func orderOperations(operations []operation) []operation {
+	var changes, deletes []operation
+	for _, op := range operations {
+		if op.Action == "delete" {
+			deletes = append(deletes, op)
+		} else {
+			changes = append(changes, op)
+		}
+	}
+
+	ordered := topologicalOrder(changes)
+	orderedDeletes := topologicalOrder(deletes)
+	for i := len(orderedDeletes) - 1; i >= 0; i-- {
+		ordered = append(ordered, orderedDeletes[i])
+	}
+	return ordered
+}
+
+// dependencyGraph maps every operation key to the keys of the operations it depends on
+func dependencyGraph(operations []operation) map[string]map[string]bool {
+	datasets := make(map[string]string)
+	contents := make(map[string]string)
+	producers := make(map[string][]string)
+	for _, op := range operations {
+		switch op.Config.Type {
+		case "dataset":
+			datasets[op.Config.Id] = nodeKey(op.Config)
+		case "content":
+			contents[op.Config.Id] = nodeKey(op.Config)
+		case "job":
+			if _, ok := op.Config.JsonContent["sink"].(map[string]interface{}); ok {
+				name := determineSinkDataset(op.Config.JsonContent)
+				producers[name] = append(producers[name], nodeKey(op.Config))
+			}
+		}
+	}
+
+	graph := make(map[string]map[string]bool)
+	for _, op := range operations {
+		key := nodeKey(op.Config)
+		deps := make(map[string]bool)
+		graph[key] = deps
+		if op.Config.Type != "job" {
+			continue
+		}
+
+		// job -> sink dataset
+		if _, ok := op.Config.JsonContent["sink"].(map[string]interface{}); ok {
+			if dataset, ok := datasets[determineSinkDataset(op.Config.JsonContent)]; ok {
+				deps[dataset] = true
+			}
+		}
+		// job -> source dataset created by a dataset file, and job -> the jobs writing its source datasets
+		for _, name := range sourceDatasets(op.Config.JsonContent["source"]) {
+			if dataset, ok := datasets[name]; ok {
+				deps[dataset] = true
+			}
+			for _, producer := range producers[name] {
+				deps[producer] = true
+			}
+		}
+		// job -> content referenced by id anywhere in the job
+		walkStrings(op.Config.JsonContent, func(value string) {
+			if content, ok := contents[value]; ok {
+				deps[content] = true
+			}
+		})
+		delete(deps, key)
+	}
+	return graph
+}
+
+// topologicalOrder sorts the operations with Kahn's algorithm, picking ready operations by type and id.
+// Only jobs can depend on jobs, so a cycle is a pipeline of jobs reading each other's sink datasets. Such a
+// pipeline can be deployed in any order, so the cycle is reported and broken at the first job of it.
+func topologicalOrder(operations []operation) []operation {
+	byKey := make(map[string]operation)
+	for _, op := range operations {
+		byKey[nodeKey(op.Config)] = op
+	}
+	graph := dependencyGraph(operations)
+
+	remaining := make(map[string]int)
+	dependants := make(map[string][]string)
+	for key, deps := range graph {
+		remaining[key] = len(deps)
+		for dep := range deps {
+			dependants[dep] = append(dependants[dep], key)
+		}
+	}
+
+	var ready []string
+	for key, count := range remaining {
+		if count == 0 {
+			ready = append(ready, key)
+		}
+	}
+
+	var ordered []operation
+	for len(ordered) < len(byKey) {
+		if len(ready) == 0 {
+			cycle := findCycle(graph, remaining)
+			pterm.Warning.Printf("The jobs %s read each other's sink datasets, deploying %s first\n", strings.Join(cycle, " -> "), cycle[0])
+			remaining[cycle[0]] = 0
+			ready = append(ready, cycle[0])
+		}
+		sort.Slice(ready, func(i, j int) bool {
+			a, b := byKey[ready[i]].Config, byKey[ready[j]].Config
+			if typeRank[a.Type] != typeRank[b.Type] {
+				return typeRank[a.Type] < typeRank[b.Type]
+			}
+			return a.Id < b.Id
+		})
+		key := ready[0]
+		ready = ready[1:]
+		ordered = append(ordered, byKey[key])
+		for _, dependant := range dependants[key] {
+			if remaining[dependant] == 0 {
+				// a job released to break a cycle
+				continue
+			}
+			remaining[dependant]--
+			if remaining[dependant] == 0 {
+				ready = append(ready, dependant)
+			}
+		}
+	}
+	return ordered
+}
+
+// findCycle returns one dependency cycle among the operations that could not be ordered
+func findCycle(graph map[string]map[string]bool, remaining map[string]int) []string {
+	var keys []string
+	for key, count := range remaining {
+		if count > 0 {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	visited := make(map[string]bool)
+	var path []string
+	var visit func(key string) []string
+	visit = func(key string) []string {
+		for i, onPath := range path {
+			if onPath == key {
+				return append(append([]string{}, path[i:]...), key)
+			}
+		}
+		if visited[key] {
+			return nil
+		}
+		visited[key] = true
+		path = append(path, key)
+		var deps []string
+		for dep := range graph[key] {
+			deps = append(deps, dep)
+		}
+		sort.Strings(deps)
+		for _, dep := range deps {
+			if cycle := visit(dep); cycle != nil {
+				return cycle
+			}
+		}
+		path = path[:len(path)-1]
+		return nil
+	}
+	for _, key := range keys {
+		if cycle := visit(key); cycle != nil {
+			return cycle
+		}
+	}
+	return keys
+}
+
+// sourceDatasets collects the dataset names referenced by a job source, including nested sources
+func sourceDatasets(source interface{}) []string {
+	var names []string
+	switch value := source.(type) {
+	case map[string]interface{}:
+		for key, v := range value {
+			if name, ok := v.(string); ok && (key == "Name" || key == "Dataset") {
+				names = append(names, name)
+			} else {
+				names = append(names, sourceDatasets(v)...)
+			}
+		}
+	case []interface{}:
+		for _, v := range value {
+			names = append(names, sourceDatasets(v)...)
+		}
+	}
+	return names
+}
+
+func walkStrings(value interface{}, fn func(string)) {
+	switch v := value.(type) {
+	case string:
+		fn(v)
+	case map[string]interface{}:
+		for _, child := range v {
+			walkStrings(child, fn)
+		}
+	case []interface{}:
+		for _, child := range v {
+			walkStrings(child, fn)
+		}
+	}
+}
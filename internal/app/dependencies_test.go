@@ -0,0 +1,177 @@
+package app
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func jobOp(action string, id string, source string, sink string, extra map[string]interface{}) operation {
+	content := map[string]interface{}{
+		"id":     id,
+		"type":   "job",
+		"source": map[string]interface{}{"Type": "DatasetSource", "Name": source},
+		"sink":   map[string]interface{}{"Type": "DatasetSink", "Name": sink},
+	}
+	for key, value := range extra {
+		content[key] = value
+	}
+	return operation{Action: action, Config: config{Type: "job", Id: id, JsonContent: content}}
+}
+
+func configOp(action string, configType string, id string) operation {
+	return operation{Action: action, Config: config{Type: configType, Id: id, JsonContent: map[string]interface{}{}}}
+}
+
+func operationKeys(operations []operation) []string {
+	var keys []string
+	for _, op := range operations {
+		keys = append(keys, op.Action+" "+nodeKey(op.Config))
+	}
+	return keys
+}
+
+func TestOrderOperations(t *testing.T) {
+	tests := []struct {
+		name       string
+		operations []operation
+		want       []string
+	}{
+		{
+			name: "independent operations by type and id",
+			operations: []operation{
+				configOp("add", "job", "b"),
+				configOp("add", "content", "c"),
+				configOp("add", "dataset", "d"),
+				configOp("add", "job", "a"),
+			},
+			want: []string{"add dataset:d", "add content:c", "add job:a", "add job:b"},
+		},
+		{
+			name: "datasets before the jobs reading and writing them",
+			operations: []operation{
+				jobOp("add", "a-import", "people", "people.out", nil),
+				configOp("add", "dataset", "people.out"),
+				configOp("add", "dataset", "people"),
+			},
+			want: []string{"add dataset:people", "add dataset:people.out", "add job:a-import"},
+		},
+		{
+			name: "content before the jobs referencing it",
+			operations: []operation{
+				jobOp("add", "import", "people", "people.out", map[string]interface{}{"transform": map[string]interface{}{"Config": "mapping"}}),
+				configOp("update", "content", "mapping"),
+			},
+			want: []string{"update content:mapping", "add job:import"},
+		},
+		{
+			name: "jobs after the jobs writing their source datasets",
+			operations: []operation{
+				jobOp("add", "a-report", "people.enriched", "report", nil),
+				jobOp("update", "b-enrich", "people", "people.enriched", nil),
+			},
+			want: []string{"update job:b-enrich", "add job:a-report"},
+		},
+		{
+			name: "jobs reading each others sink datasets",
+			operations: []operation{
+				jobOp("add", "b", "one", "two", nil),
+				jobOp("add", "a", "two", "one", nil),
+			},
+			want: []string{"add job:a", "add job:b"},
+		},
+		{
+			name: "cycle between the jobs around it",
+			operations: []operation{
+				jobOp("add", "c", "one", "report", nil),
+				jobOp("add", "b", "one", "two", nil),
+				jobOp("add", "a", "two", "one", nil),
+				jobOp("add", "z", "import", "two", nil),
+			},
+			want: []string{"add job:z", "add job:a", "add job:b", "add job:c"},
+		},
+		{
+			name: "deletes after changes with dependants first",
+			operations: []operation{
+				configOp("delete", "dataset", "people"),
+				jobOp("delete", "import", "people", "other", nil),
+				configOp("add", "dataset", "new"),
+			},
+			want: []string{"add dataset:new", "delete job:import", "delete dataset:people"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := operationKeys(orderOperations(tt.operations)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("orderOperations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindCycle(t *testing.T) {
+	deps := func(keys ...string) map[string]bool {
+		m := make(map[string]bool)
+		for _, key := range keys {
+			m[key] = true
+		}
+		return m
+	}
+	tests := []struct {
+		name      string
+		graph     map[string]map[string]bool
+		remaining map[string]int
+		want      []string
+	}{
+		{
+			name:      "two nodes",
+			graph:     map[string]map[string]bool{"job:a": deps("job:b"), "job:b": deps("job:a")},
+			remaining: map[string]int{"job:a": 1, "job:b": 1},
+			want:      []string{"job:a", "job:b", "job:a"},
+		},
+		{
+			name: "cycle behind a blocked node",
+			graph: map[string]map[string]bool{
+				"job:a": deps("job:b"),
+				"job:b": deps("job:c"),
+				"job:c": deps("job:d"),
+				"job:d": deps("job:c"),
+			},
+			remaining: map[string]int{"job:a": 1, "job:b": 1, "job:c": 1, "job:d": 1},
+			want:      []string{"job:c", "job:d", "job:c"},
+		},
+		{
+			name:      "self dependency",
+			graph:     map[string]map[string]bool{"job:a": deps("job:a")},
+			remaining: map[string]int{"job:a": 1},
+			want:      []string{"job:a", "job:a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := findCycle(tt.graph, tt.remaining); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findCycle() = %s, want %s", strings.Join(got, " -> "), strings.Join(tt.want, " -> "))
+			}
+		})
+	}
+}
+
+func TestSourceDatasets(t *testing.T) {
+	source := map[string]interface{}{
+		"Type": "MultiSource",
+		"Name": "people",
+		"Dependencies": []interface{}{
+			map[string]interface{}{"Dataset": "addresses"},
+		},
+	}
+	got := sourceDatasets(source)
+	want := map[string]bool{"people": true, "addresses": true}
+	if len(got) != len(want) {
+		t.Fatalf("sourceDatasets() = %v, want %v", got, want)
+	}
+	for _, name := range got {
+		if !want[name] {
+			t.Errorf("sourceDatasets() = %v, want %v", got, want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+)
+
+// Change is a single difference between two json documents, addressed by its json path
+type Change struct {
+	Path string      `json:"path"`
+	Kind string      `json:"kind"`
+	Old  interface{} `json:"old,omitempty"`
+	New  interface{} `json:"new,omitempty"`
+}
+
+func (c Change) String() string {
+	switch c.Kind {
+	case "added":
+		return fmt.Sprintf("+ %s: %s", c.Path, format(c.New))
+	case "removed":
+		return fmt.Sprintf("- %s: %s", c.Path, format(c.Old))
+	default:
+		return fmt.Sprintf("~ %s: %s => %s", c.Path, format(c.Old), format(c.New))
+	}
+}
+
+// Json returns the added, removed and changed values between two unmarshalled json documents,
+// sorted by path. Arrays are compared element by element.
+func Json(old interface{}, new interface{}) []Change {
+	var changes []Change
+	compare("$", old, new, &changes)
+	return changes
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func childPath(path string, key string) string {
+	if identifier.MatchString(key) {
+		return path + "." + key
+	}
+	quoted, _ := json.Marshal(key)
+	return path + "[" + string(quoted) + "]"
+}
+
+func compare(path string, old interface{}, new interface{}, changes *[]Change) {
+	switch oldValue := old.(type) {
+	case map[string]interface{}:
+		newValue, ok := new.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make(map[string]bool)
+		for key := range oldValue {
+			keys[key] = true
+		}
+		for key := range newValue {
+			keys[key] = true
+		}
+		var sorted []string
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+		for _, key := range sorted {
+			oldChild, inOld := oldValue[key]
+			newChild, inNew := newValue[key]
+			switch {
+			case !inOld:
+				*changes = append(*changes, Change{Path: childPath(path, key), Kind: "added", New: newChild})
+			case !inNew:
+				*changes = append(*changes, Change{Path: childPath(path, key), Kind: "removed", Old: oldChild})
+			default:
+				compare(childPath(path, key), oldChild, newChild, changes)
+			}
+		}
+		return
+	case []interface{}:
+		newValue, ok := new.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(oldValue) || i < len(newValue); i++ {
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			switch {
+			case i >= len(oldValue):
+				*changes = append(*changes, Change{Path: itemPath, Kind: "added", New: newValue[i]})
+			case i >= len(newValue):
+				*changes = append(*changes, Change{Path: itemPath, Kind: "removed", Old: oldValue[i]})
+			default:
+				compare(itemPath, oldValue[i], newValue[i], changes)
+			}
+		}
+		return
+	}
+	if !reflect.DeepEqual(old, new) {
+		*changes = append(*changes, Change{Path: path, Kind: "changed", Old: old, New: new})
+	}
+}
+
+func format(value interface{}) string {
+	formatted, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	if len(formatted) > 120 {
+		return string(formatted[:117]) + "..."
+	}
+	return string(formatted)
+}
@@ -0,0 +1,113 @@
+package app
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/diff"
+	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
+	"github.com/pterm/pterm"
+	"path/filepath"
+	"strings"
+)
+
+// addTransformDiffs adds a unified diff of the transform to the job updates where the transform changed.
+// The previous transform is read from the manifest in the datahub, or from the job in the datahub when the
+// manifest was written before transforms were stored in it.
+func (app *App) addTransformDiffs(previousManifest *Manifest, operations []operation) {
+	previousCode, err := previousManifest.transformCode()
+	if err != nil {
+		pterm.Warning.Printf("Failed to read the transforms of the manifest in the datahub, diffing against the jobs instead: %s\n", err)
+	}
+	for i, op := range operations {
+		if op.Action != "update" || !op.HasJSTransform || op.Diff == nil {
+			continue
+		}
+		previous, ok := previousCode[previousManifest.Manifest[op.Config.Id].TransformDigest]
+		if !ok {
+			previous, err = app.remoteTransform(op.Config.Id)
+			if err != nil {
+				continue
+			}
+		}
+		if digestCode(previous) == op.Config.TransformDigest {
+			continue
+		}
+
+		transformName, current, err := app.readTransform(op.Config)
+		if err != nil {
+			continue
+		}
+		name := filepath.Join(app.Env.Project.Transforms, transformName)
+		if transformPath(op.Config.JsonContent) == "" {
+			// inline transforms are compared against the job they are written in
+			name = op.Config.Path
+		}
+		if app.restoring != nil {
+			name = app.restoring.Id + "/" + transformName
+		}
+		operations[i].Diff.TransformDiff = diff.Unified("datahub/"+op.Config.Id, name, string(previous), string(current), 3)
+	}
+}
+
+// remoteTransform returns the code of the transform of a job in the datahub
+func (app *App) remoteTransform(id string) ([]byte, error) {
+	remoteJob, err := app.Client.GetJob(id)
+	if err != nil {
+		return nil, err
+	}
+	remoteContent, err := utils.ReadJson(remoteJob)
+	if err != nil {
+		return nil, err
+	}
+	remoteTransform, _ := remoteContent["transform"].(map[string]interface{})
+	code, _ := remoteTransform["Code"].(string)
+	return base64.StdEncoding.DecodeString(code)
+}
+
+// printDiffs shows what each update operation changes
+func (app *App) printDiffs(operations []operation) {
+	for _, op := range operations {
+		if op.Diff == nil {
+			continue
+		}
+		var lines []string
+		for _, change := range op.Diff.Changes {
+			lines = append(lines, change.String())
+		}
+		if op.Diff.SecretChanged {
+			lines = append(lines, "~ a secret changed")
+		}
+		if op.Diff.TransformDiff != "" {
+			if len(lines) > 0 {
+				lines = append(lines, "")
+			}
+			lines = append(lines, strings.Split(strings.TrimSuffix(op.Diff.TransformDiff, "\n"), "\n")...)
+		}
+		if len(lines) == 0 {
+			lines = append(lines, "transform changed")
+		}
+		if app.Env.LogFormat != "github" {
+			for i, line := range lines {
+				lines[i] = colorDiffLine(line)
+			}
+		}
+		title := fmt.Sprintf("Changes in %s '%s' (%s)", op.Config.Type, op.Config.Id, op.ConfigPath)
+		utils.LogGroup(title, lines, app.Env.LogFormat)
+	}
+}
+
+func colorDiffLine(line string) string {
+	switch {
+	case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+		return pterm.Bold.Sprint(line)
+	case strings.HasPrefix(line, "@@"):
+		return pterm.FgCyan.Sprint(line)
+	case strings.HasPrefix(line, "+"):
+		return pterm.FgGreen.Sprint(line)
+	case strings.HasPrefix(line, "-"):
+		return pterm.FgRed.Sprint(line)
+	case strings.HasPrefix(line, "~"):
+		return pterm.FgYellow.Sprint(line)
+	}
+	return line
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/datahub"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/environment"
+	"strings"
+	"testing"
+)
+
+// jobClient returns jobs with a javascript transform, and counts how often a job is read
+type jobClient struct {
+	datahub.Client
+	transforms map[string]string
+	reads      int
+}
+
+func (c *jobClient) GetJob(id string) ([]byte, error) {
+	c.reads++
+	return json.Marshal(map[string]interface{}{
+		"id":        id,
+		"transform": map[string]interface{}{"Type": "JavascriptTransform", "Code": base64.StdEncoding.EncodeToString([]byte(c.transforms[id]))},
+	})
+}
+
+func TestAddTransformDiffs(t *testing.T) {
+	current := []byte("const v = 2;\n")
+	tests := []struct {
+		name string
+		// stored is the previous transform in the manifest, empty for manifests without transforms
+		stored string
+		remote string
+		want   string
+		reads  int
+	}{
+		{name: "from the manifest", stored: "const v = 1;\n", remote: "const v = 0;\n", want: "-const v = 1;"},
+		{name: "from the job without a stored transform", remote: "const v = 0;\n", want: "-const v = 0;", reads: 1},
+		{name: "unchanged", stored: "const v = 2;\n", remote: "const v = 0;\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &jobClient{transforms: map[string]string{"job1": tt.remote}}
+			app := &App{
+				Env:        &environment.Environment{Project: &environment.Project{Transforms: "transforms"}},
+				Client:     client,
+				transforms: map[string][]byte{digestCode(current): current},
+			}
+			jsonContent := map[string]interface{}{"transform": map[string]interface{}{"Type": "JavascriptTransform", "Path": "t.js"}}
+			previousManifest := &Manifest{Manifest: map[string]config{"job1": {Id: "job1", Type: "job", JsonContent: jsonContent}}}
+			if tt.stored != "" {
+				digest := digestCode([]byte(tt.stored))
+				previousManifest.Manifest["job1"] = config{Id: "job1", Type: "job", JsonContent: jsonContent, TransformDigest: digest}
+				previousManifest.Transforms = map[string]manifestTransform{digest: {Code: tt.stored}}
+			}
+			operations := []operation{{
+				Action:         "update",
+				HasJSTransform: true,
+				Config:         config{Id: "job1", Type: "job", JsonContent: jsonContent, TransformDigest: digestCode(current)},
+				Diff:           &configDiff{},
+			}}
+
+			app.addTransformDiffs(previousManifest, operations)
+			got := operations[0].Diff.TransformDiff
+			if tt.want == "" && got != "" {
+				t.Errorf("unchanged transform has the diff %q", got)
+			}
+			if tt.want != "" && (!strings.Contains(got, tt.want) || !strings.Contains(got, "+const v = 2;")) {
+				t.Errorf("diff = %q, want it to contain %q", got, tt.want)
+			}
+			if client.reads != tt.reads {
+				t.Errorf("the job was read %d times, want %d", client.reads, tt.reads)
+			}
+		})
+	}
+}
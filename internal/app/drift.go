@@ -0,0 +1,260 @@
+package app
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/datahub"
+	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
+	"github.com/pterm/pterm"
+	"sort"
+)
+
+type driftResult struct {
+	Id     string `json:"id"`
+	Type   string `json:"type"`
+	Path   string `json:"path"`
+	State  string `json:"state"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Drift compares the jobs and content owned by the manifest with their live version in the datahub
+func (app *App) Drift(repair bool) error {
+	err := app.Connect()
+	if err != nil {
+		return err
+	}
+	if !repair {
+		return app.drift(false)
+	}
+	// repairs write to the datahub, so they must not run at the same time as a deployment
+	lock, err := app.M.acquireLock()
+	if err != nil {
+		return err
+	}
+	err = app.drift(true)
+	return errors.Join(err, app.M.releaseLock(lock))
+}
+
+func (app *App) drift(repair bool) error {
+	manifest, err := app.M.getManifestFromDatahub()
+	if err != nil {
+		return fmt.Errorf("unable to detect drift without a manifest in the datahub: %w", err)
+	}
+	app.transforms, err = manifest.transformCode()
+	if err != nil {
+		return err
+	}
+
+	var keys []string
+	for key := range manifest.Manifest {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var results []driftResult
+	drifted := 0
+	for _, key := range keys {
+		c := manifest.Manifest[key]
+		if c.Type != "job" && c.Type != "content" {
+			continue
+		}
+		result, err := app.detectDrift(c)
+		if err != nil {
+			return err
+		}
+		results = append(results, result)
+		if result.State != "in sync" {
+			drifted++
+		}
+	}
+
+	app.printDrift(results)
+	if drifted == 0 {
+		pterm.Success.Println("No drift detected, the datahub matches the manifest.")
+		return nil
+	}
+	if !repair {
+		return fmt.Errorf("drift detected in %d of %d configs, use --repair to restore them from the manifest", drifted, len(results))
+	}
+
+	for _, result := range results {
+		if result.State == "in sync" {
+			continue
+		}
+		err := app.repairDrift(manifest.Manifest[result.Id])
+		if err != nil {
+			return err
+		}
+	}
+	if app.Env.DryRun {
+		pterm.Success.Println("Dry run drift repair finished. To repair the datahub, set flag --dry-run=false")
+	} else {
+		pterm.Success.Printf("Repaired %d configs.\n", drifted)
+	}
+	return nil
+}
+
+func (app *App) detectDrift(c config) (driftResult, error) {
+	result := driftResult{Id: c.Id, Type: c.Type, Path: c.Path, State: "in sync"}
+	var remote []byte
+	var err error
+	if c.Type == "job" {
+		remote, err = app.Client.GetJob(c.Id)
+	} else {
+		remote, err = app.Client.GetContent(c.Id)
+	}
+	if datahub.IsNotFound(err) {
+		result.State = "missing"
+		return result, nil
+	}
+	if err != nil {
+		return result, fmt.Errorf("failed to read %s '%s' from datahub: %w", c.Type, c.Id, err)
+	}
+
+	remoteContent, err := utils.ReadJson(remote)
+	if err != nil {
+		return result, fmt.Errorf("failed to parse %s '%s' from datahub: %w", c.Type, c.Id, err)
+	}
+
+	if c.Type == "job" && hasJSTransform(c.JsonContent) {
+		// the remote job holds the transform code instead of the path to the transform file
+		remoteTransform, _ := remoteContent["transform"].(map[string]interface{})
+		code, _ := remoteTransform["Code"].(string)
+		decoded, err := base64.StdEncoding.DecodeString(code)
+		hasher := md5.New()
+		hasher.Write(decoded)
+		if err != nil || hex.EncodeToString(hasher.Sum(nil)) != c.TransformDigest {
+			result.State = "modified"
+			result.Detail = "transform"
+		}
+		delete(remoteContent, "transform")
+	}
+
+	// secrets are redacted in the manifest, so a secret changed in the datahub is not detected
+	remoteContent, _ = redactLike(c.JsonContent, remoteContent).(map[string]interface{})
+	localContent := normaliseConfig(c.JsonContent, c.Type)
+	if c.Type == "job" && hasJSTransform(c.JsonContent) {
+		delete(localContent, "transform")
+	}
+	localDigest, err := createDigest(localContent)
+	if err != nil {
+		return result, err
+	}
+	remoteDigest, err := createDigest(normaliseConfig(remoteContent, c.Type))
+	if err != nil {
+		return result, err
+	}
+	if localDigest != remoteDigest {
+		result.State = "modified"
+		if result.Detail != "" {
+			result.Detail = "config and transform"
+		} else {
+			result.Detail = "config"
+		}
+	}
+	return result, nil
+}
+
+// normaliseConfig removes the values the datahub adds or drops when a config is stored, so that
+// the local and the remote version of a config produce the same digest
+func normaliseConfig(content map[string]interface{}, configType string) map[string]interface{} {
+	normalised, _ := normaliseValue(content).(map[string]interface{})
+	if normalised == nil {
+		normalised = make(map[string]interface{})
+	}
+	if configType == "job" {
+		// the type property is only used by mim-deploy and is not part of the job configuration
+		delete(normalised, "type")
+	}
+	return normalised
+}
+
+func normaliseValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{})
+		for key, child := range v {
+			if normalisedChild := normaliseValue(child); normalisedChild != nil {
+				result[key] = normalisedChild
+			}
+		}
+		if len(result) == 0 {
+			return nil
+		}
+		return result
+	case []interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+		result := make([]interface{}, len(v))
+		for i, child := range v {
+			result[i] = normaliseValue(child)
+		}
+		return result
+	case string:
+		if v == "" {
+			return nil
+		}
+	case bool:
+		if !v {
+			return nil
+		}
+	case float64:
+		if v == 0 {
+			return nil
+		}
+	}
+	return value
+}
+
+func (app *App) repairDrift(c config) error {
+	if hasRedactedValues(c.JsonContent) {
+		return fmt.Errorf("unable to repair %s '%s', the manifest does not hold its secrets, deploy it from the config files instead", c.Type, c.Id)
+	}
+	jsonContent, err := json.Marshal(c.JsonContent)
+	if err != nil {
+		return err
+	}
+	if c.Type == "content" {
+		return app.Client.AddContent(jsonContent)
+	}
+
+	var transform *datahub.Transform
+	if hasJSTransform(c.JsonContent) {
+		// manifests written by older versions do not hold the transforms
+		transformPath, code, err := app.readTransform(c)
+		if err != nil {
+			return fmt.Errorf("unable to repair job '%s', the transform '%s' is not stored in the manifest, deploy it from the config files instead", c.Id, transformPath)
+		}
+		transform = &datahub.Transform{Name: transformPath, Code: code}
+	}
+	return app.Client.AddJob(jsonContent, transform)
+}
+
+func (app *App) printDrift(results []driftResult) {
+	if app.Env.EnableJsonOut {
+		jsonResults, _ := json.Marshal(results)
+		fmt.Println(string(jsonResults))
+		return
+	}
+	if app.Env.LogFormat == "github" {
+		for _, result := range results {
+			if result.State != "in sync" {
+				utils.LogError(utils.ErrorDetails{
+					File:    result.Path,
+					Message: fmt.Sprintf("%s '%s' is %s in the datahub", result.Type, result.Id, result.State),
+				}, app.Env.LogFormat)
+			}
+		}
+		return
+	}
+	data := pterm.TableData{{"Type", "Id", "State", "Changed"}}
+	for _, result := range results {
+		data = append(data, []string{result.Type, result.Id, result.State, result.Detail})
+	}
+	_ = pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+}
@@ -6,48 +6,70 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 type Environment struct {
 	MimServer               string
 	Token                   string
+	TokenStdIn              bool
 	RootPath                string
 	OutputPath              string
 	IgnorePath              []string
-	EnvironmentFile         string
+	EnvironmentFiles        []string
 	DryRun                  bool
 	CreateManifestIfMissing bool
 	AbortOnMissingSecret    bool
 	EnableJsonOut           bool
 	EnableManifest          bool
 	LogFormat               string
+	ClientBackend           string
+	RollbackOnFailure       bool
+	SecretProvider          string
+	TemplateEngine          string
+	CompressTransforms      bool
+	SecretsFile             string
+	AgeIdentity             string
+	VaultAddr               string
+	VaultToken              string
+	VaultMount              string
+	Project                 *Project
+	ManifestId              string
+	LockTimeout             time.Duration
+	LockTtl                 time.Duration
 }
 
 func (env *Environment) GetConfigFiles() ([]string, error) {
 	pterm.Info.Printf("Reading files from %s\n", env.RootPath)
-	includedSubdirs := []string{"jobs", "job", "contents", "content", "transform", "transforms", "dataset", "datasets"}
+	ignore, err := env.IgnoreRules()
+	if err != nil {
+		return nil, err
+	}
 	var files []string
-	for _, subPath := range includedSubdirs {
+	for _, subPath := range env.Project.directories() {
 		fullPath := filepath.Join(env.RootPath, subPath)
 		if _, err := os.Stat(fullPath); os.IsNotExist(err) {
 			continue
 		}
-		err := filepath.Walk(filepath.Join(env.RootPath, subPath), func(path string, info os.FileInfo, err error) error {
+		err = filepath.Walk(fullPath, func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
-			if info.IsDir() && contains(env.IgnorePath, path) {
+			relPath, _ := filepath.Rel(env.RootPath, path)
+			if info.IsDir() && ignore.Ignored(relPath, true) {
 				pterm.Info.Println("ignoring path ", path)
 				return filepath.SkipDir
 			}
-			if info.IsDir() {
+			if info.IsDir() || ignore.Ignored(relPath, false) {
 				return nil
 			}
-			//this check is too strict for transforms
-			if filepath.Ext(path) != ".json" {
+			if !contains(utils.ConfigExtensions, strings.ToLower(filepath.Ext(path))) {
 				return nil
 			}
-			files = append(files, path)
+			// nested config directories are walked by themselves, so their files are only added once
+			if !contains(files, path) {
+				files = append(files, path)
+			}
 			return nil
 		})
 		if err != nil {
@@ -58,33 +80,90 @@ func (env *Environment) GetConfigFiles() ([]string, error) {
 	return files, nil
 }
 
+// IgnoreRules returns the ignore patterns of the project, the .mimdeployignore file, the environment being
+// deployed and the ignore flag, in that order. A flag value naming an existing path ignores exactly that path.
+func (env *Environment) IgnoreRules() (*IgnoreRules, error) {
+	rules := &IgnoreRules{}
+	if err := rules.Add(env.Project.Ignore...); err != nil {
+		return nil, err
+	}
+	if err := rules.AddFile(filepath.Join(env.RootPath, IgnoreFileName)); err != nil {
+		return nil, err
+	}
+	if len(env.Project.Environments) > 0 && len(env.EnvironmentFiles) > 0 {
+		variables, err := env.LoadVariables()
+		if err != nil {
+			return nil, err
+		}
+		if err := rules.Add(env.Project.Environments[env.Name(variables.Values)].Ignore...); err != nil {
+			return nil, err
+		}
+	}
+	for _, ignorePath := range env.IgnorePath {
+		if _, err := os.Stat(ignorePath); err == nil {
+			if relPath, err := filepath.Rel(env.RootPath, ignorePath); err == nil && !strings.HasPrefix(relPath, "..") {
+				ignorePath = "/" + filepath.ToSlash(relPath)
+			}
+		}
+		if err := rules.Add(ignorePath); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
 func (env *Environment) GetEnvironmentVariables() (map[string]interface{}, error) {
-	pterm.Info.Printf("Reading Env file %s\n", env.EnvironmentFile)
-	vars, err := utils.ReadJsonFile(env.EnvironmentFile)
+	pterm.Info.Printf("Reading Env files %s\n", strings.Join(env.EnvironmentFiles, ", "))
+	vars, err := env.LoadVariables()
 	if err != nil {
 		pterm.Error.Println(err)
 		return nil, err
 	}
-	return vars, nil
+	return vars.Values, nil
 }
 
+// GetConfigType returns the type of the configs in the directory of a config file, or unknown
+// when the file is not in a config directory of the project
 func (env *Environment) GetConfigType(path string) string {
-
 	relPath, _ := filepath.Rel(env.RootPath, path)
-	typeDir := strings.Split(relPath, string(os.PathSeparator))
-	switch typeDir[0] {
-	case "jobs":
-		return "job"
-	case "contents", "content":
-		return "content"
-	case "transforms":
-		return "transform"
-	case "dataset":
-		return "dataset"
-	default:
-		return "unknown"
+	return env.Project.configType(relPath)
+}
+
+// TransformPath returns the full path of a javascript transform from its path in a job
+func (env *Environment) TransformPath(transformPath string) string {
+	return filepath.Join(env.RootPath, env.Project.Transforms, transformPath)
+}
+
+// Client returns the DataHub client to use. The auto client is the mim cli when the transforms directory holds
+// typescript transforms, as only the mim cli compiles them, and the REST API otherwise.
+func (env *Environment) Client() string {
+	if env.ClientBackend != "auto" {
+		return env.ClientBackend
+	}
+	if env.RootPath == "" || env.Project == nil {
+		return "http"
+	}
+	typescript := false
+	_ = filepath.Walk(filepath.Join(env.RootPath, env.Project.Transforms), func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && strings.HasSuffix(path, ".ts") {
+			typescript = true
+			return filepath.SkipAll
+		}
+		return nil
+	})
+	if typescript {
+		return "mim"
+	}
+	return "http"
+}
 
+// IncludeRoots returns the full paths of the directories includes are looked up in
+func (env *Environment) IncludeRoots() []string {
+	roots := make([]string, len(env.Project.IncludeRoots))
+	for i, root := range env.Project.IncludeRoots {
+		roots[i] = filepath.Join(env.RootPath, root)
 	}
+	return roots
 }
 
 func contains(elems []string, v string) bool {
@@ -0,0 +1,143 @@
+package environment
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFileName is the name of the ignore file in the root path
+const IgnoreFileName = ".mimdeployignore"
+
+// ignoreRule is a single gitignore style pattern
+type ignoreRule struct {
+	pattern string
+	negate  bool
+	dirOnly bool
+	regex   *regexp.Regexp
+}
+
+// IgnoreRules decides which files and directories are left out of a deployment. Rules are gitignore style
+// patterns, relative to the root path, and the last matching rule wins.
+type IgnoreRules struct {
+	rules []ignoreRule
+}
+
+// Add adds the patterns in order. Empty patterns and patterns starting with # are skipped.
+func (r *IgnoreRules) Add(patterns ...string) error {
+	for _, pattern := range patterns {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" || strings.HasPrefix(pattern, "#") {
+			continue
+		}
+		rule := ignoreRule{pattern: pattern}
+		if strings.HasPrefix(pattern, "!") {
+			rule.negate = true
+			pattern = pattern[1:]
+		}
+		if strings.HasSuffix(pattern, "/") {
+			rule.dirOnly = true
+			pattern = strings.TrimSuffix(pattern, "/")
+		}
+		// a pattern with a slash before its end is relative to the root, otherwise it matches at any depth
+		anchored := strings.Contains(pattern, "/")
+		pattern = strings.TrimPrefix(pattern, "/")
+		expr := globToRegexp(pattern)
+		if !anchored {
+			expr = "(.*/)?" + expr
+		}
+		regex, err := regexp.Compile("^" + expr + "$")
+		if err != nil {
+			return fmt.Errorf("invalid ignore pattern '%s': %w", rule.pattern, err)
+		}
+		rule.regex = regex
+		r.rules = append(r.rules, rule)
+	}
+	return nil
+}
+
+// AddFile adds the patterns of an ignore file, one pattern per line. A missing file adds nothing.
+func (r *IgnoreRules) AddFile(file string) error {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil
+	}
+	content, err := utils.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var patterns []string
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		patterns = append(patterns, scanner.Text())
+	}
+	if err := r.Add(patterns...); err != nil {
+		return fmt.Errorf("failed to read '%s': %w", file, err)
+	}
+	return nil
+}
+
+// Ignored returns true if the file or directory at relPath is ignored. A path inside an ignored
+// directory is always ignored, like in git.
+func (r *IgnoreRules) Ignored(relPath string, isDir bool) bool {
+	relPath = filepath.ToSlash(filepath.Clean(relPath))
+	if relPath == "." {
+		return false
+	}
+	if parent := path.Dir(relPath); parent != "." && r.Ignored(parent, true) {
+		return true
+	}
+	ignored := false
+	for _, rule := range r.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.regex.MatchString(relPath) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// globToRegexp translates a glob with *, ?, ** and character classes to a regular expression
+func globToRegexp(glob string) string {
+	var expr strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			expr.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			expr.WriteString(".*")
+			i++
+		case c == '*':
+			expr.WriteString("[^/]*")
+		case c == '?':
+			expr.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				expr.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			expr.WriteString("[" + class + "]")
+			i += end
+		case c == '\\' && i+1 < len(glob):
+			expr.WriteString(regexp.QuoteMeta(string(glob[i+1])))
+			i++
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return expr.String()
+}
@@ -0,0 +1,101 @@
+package environment
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob string
+		want string
+	}{
+		{glob: "job.json", want: `job\.json`},
+		{glob: "*.json", want: `[^/]*\.json`},
+		{glob: "job?.json", want: `job[^/]\.json`},
+		{glob: "**/test", want: `(.*/)?test`},
+		{glob: "jobs/**", want: `jobs/.*`},
+		{glob: "a/**/b", want: `a/(.*/)?b`},
+		{glob: "job[0-9].json", want: `job[0-9]\.json`},
+		{glob: "job[!0-9].json", want: `job[^0-9]\.json`},
+		{glob: "job[.json", want: `job\[\.json`},
+		{glob: `\*.json`, want: `\*\.json`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.glob, func(t *testing.T) {
+			if got := globToRegexp(tt.glob); got != tt.want {
+				t.Errorf("globToRegexp(%q) = %q, want %q", tt.glob, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIgnored(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{name: "no rules", path: "jobs/job.json"},
+		{name: "name at any depth", patterns: []string{"job.json"}, path: "jobs/sub/job.json", want: true},
+		{name: "wildcard", patterns: []string{"*.tmp.json"}, path: "jobs/job.tmp.json", want: true},
+		{name: "wildcard stays in segment", patterns: []string{"jobs/*.json"}, path: "jobs/sub/job.json"},
+		{name: "anchored pattern", patterns: []string{"/job.json"}, path: "jobs/job.json"},
+		{name: "anchored pattern at root", patterns: []string{"/job.json"}, path: "job.json", want: true},
+		{name: "double star prefix", patterns: []string{"**/drafts"}, path: "jobs/a/drafts", isDir: true, want: true},
+		{name: "double star suffix", patterns: []string{"jobs/**"}, path: "jobs/a/b.json", want: true},
+		{name: "double star in between", patterns: []string{"jobs/**/b.json"}, path: "jobs/b.json", want: true},
+		{name: "dir only matches dir", patterns: []string{"drafts/"}, path: "jobs/drafts", isDir: true, want: true},
+		{name: "dir only skips file", patterns: []string{"drafts/"}, path: "jobs/drafts"},
+		{name: "inside ignored dir", patterns: []string{"drafts/"}, path: "jobs/drafts/job.json", want: true},
+		{name: "negation", patterns: []string{"*.json", "!keep.json"}, path: "jobs/keep.json"},
+		{name: "last rule wins", patterns: []string{"!keep.json", "*.json"}, path: "jobs/keep.json", want: true},
+		{name: "negation inside ignored dir", patterns: []string{"drafts/", "!drafts/keep.json"}, path: "drafts/keep.json", want: true},
+		{name: "comments and blank lines", patterns: []string{"# job.json", "", "  "}, path: "job.json"},
+		{name: "root is never ignored", patterns: []string{"*"}, path: "."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := &IgnoreRules{}
+			if err := rules.Add(tt.patterns...); err != nil {
+				t.Fatal(err)
+			}
+			if got := rules.Ignored(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("Ignored(%q, %v) with %q = %v, want %v", tt.path, tt.isDir, tt.patterns, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddFile(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, IgnoreFileName)
+	if err := os.WriteFile(file, []byte("# drafts\ndrafts/\n*.bak\n!keep.bak\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules := &IgnoreRules{}
+	if err := rules.AddFile(file); err != nil {
+		t.Fatal(err)
+	}
+	if err := rules.AddFile(filepath.Join(dir, "missing")); err != nil {
+		t.Fatalf("a missing ignore file should add nothing, got %v", err)
+	}
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{path: "drafts", isDir: true, want: true},
+		{path: "jobs/job.bak", want: true},
+		{path: "jobs/keep.bak"},
+		{path: "jobs/job.json"},
+	}
+	for _, tt := range tests {
+		if got := rules.Ignored(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("Ignored(%q, %v) = %v, want %v", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package environment
+
+import (
+	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
+	"gopkg.in/yaml.v3"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ProjectFileNames are the names the project file is looked up with in the root path
+var ProjectFileNames = []string{"mim-deploy.yaml", "mim-deploy.yml"}
+
+// configTypes are the config types a directory can contain
+var configTypes = []string{"job", "content", "dataset"}
+
+// Project describes the layout of a config directory. Paths are relative to the root path.
+type Project struct {
+	// Directories maps the directories with config files to the type of the configs in them
+	Directories map[string]string `yaml:"directories"`
+	// Transforms is the directory the paths of javascript transforms are relative to
+	Transforms string `yaml:"transforms"`
+	// IncludeRoots are the directories include paths are looked up in, in order
+	IncludeRoots []string `yaml:"includeRoots"`
+	// Ignore are gitignore style patterns of files and directories that are never deployed
+	Ignore []string `yaml:"ignore"`
+	// Environments are settings for a single environment, by the name of the environment
+	Environments map[string]ProjectEnvironment `yaml:"environments"`
+	// Flags are defaults for command line flags that are not given
+	Flags map[string]interface{} `yaml:"flags"`
+}
+
+// ProjectEnvironment are the project settings that only apply when deploying a single environment
+type ProjectEnvironment struct {
+	// Ignore are ignore patterns added to those of the project
+	Ignore []string `yaml:"ignore"`
+}
+
+// DefaultProject returns the layout used when the root path has no project file
+func DefaultProject() *Project {
+	return &Project{
+		Directories: map[string]string{
+			"jobs":     "job",
+			"job":      "job",
+			"contents": "content",
+			"content":  "content",
+			"dataset":  "dataset",
+			"datasets": "dataset",
+		},
+		Transforms:   "transforms",
+		IncludeRoots: []string{"."},
+	}
+}
+
+// LoadProject reads the project file in the root path. Settings missing in the file, or a missing
+// file, use the default layout.
+func LoadProject(rootPath string) (*Project, error) {
+	project := &Project{}
+	for _, name := range ProjectFileNames {
+		file := filepath.Join(rootPath, name)
+		if _, err := os.Stat(file); os.IsNotExist(err) {
+			continue
+		}
+		content, err := utils.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(content, project); err != nil {
+			return nil, fmt.Errorf("failed to read project file '%s': %w", file, err)
+		}
+		if err := project.validate(); err != nil {
+			return nil, fmt.Errorf("invalid project file '%s': %w", file, err)
+		}
+		break
+	}
+
+	defaults := DefaultProject()
+	if len(project.Directories) == 0 {
+		project.Directories = defaults.Directories
+	}
+	if project.Transforms == "" {
+		project.Transforms = defaults.Transforms
+	}
+	if len(project.IncludeRoots) == 0 {
+		project.IncludeRoots = defaults.IncludeRoots
+	}
+	return project, nil
+}
+
+func (p *Project) validate() error {
+	for dir, configType := range p.Directories {
+		if !contains(configTypes, configType) {
+			return fmt.Errorf("directory '%s' has the unknown config type '%s', expected one of %s", dir, configType, strings.Join(configTypes, ", "))
+		}
+	}
+	rules := &IgnoreRules{}
+	if err := rules.Add(p.Ignore...); err != nil {
+		return err
+	}
+	for _, environment := range p.Environments {
+		if err := rules.Add(environment.Ignore...); err != nil {
+			return err
+		}
+	}
+	if _, exists := p.Flags["path"]; exists {
+		return fmt.Errorf("the path flag can not be set in the project file")
+	}
+	return nil
+}
+
+// directories returns the config directories in sorted order
+func (p *Project) directories() []string {
+	var dirs []string
+	for dir := range p.Directories {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// configType returns the type of the configs in the directory containing relPath. When config
+// directories are nested, the deepest one is used. A directory of "." or "" is the root path, which
+// contains every file that is not outside of it.
+func (p *Project) configType(relPath string) string {
+	configType, longest := "unknown", -1
+	relPath = filepath.Clean(relPath)
+	for dir, dirType := range p.Directories {
+		dir = filepath.Clean(dir)
+		var inDir bool
+		if dir == "." {
+			inDir = relPath != ".." && !strings.HasPrefix(relPath, ".."+string(os.PathSeparator))
+			dir = ""
+		} else {
+			inDir = strings.HasPrefix(relPath, dir+string(os.PathSeparator))
+		}
+		if inDir && len(dir) > longest {
+			configType, longest = dirType, len(dir)
+		}
+	}
+	return configType
+}
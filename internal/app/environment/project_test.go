@@ -0,0 +1,32 @@
+package environment
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestConfigType(t *testing.T) {
+	tests := []struct {
+		name        string
+		directories map[string]string
+		path        string
+		want        string
+	}{
+		{name: "config directory", directories: map[string]string{"jobs": "job"}, path: "jobs/import.json", want: "job"},
+		{name: "outside the config directories", directories: map[string]string{"jobs": "job"}, path: "other/import.json", want: "unknown"},
+		{name: "directory with a similar name", directories: map[string]string{"jobs": "job"}, path: "jobs-old/import.json", want: "unknown"},
+		{name: "deepest directory", directories: map[string]string{"jobs": "job", "jobs/content": "content"}, path: "jobs/content/mapping.json", want: "content"},
+		{name: "root directory", directories: map[string]string{".": "job"}, path: "import.json", want: "job"},
+		{name: "empty root directory", directories: map[string]string{"": "content"}, path: "nested/mapping.json", want: "content"},
+		{name: "root directory with a nested directory", directories: map[string]string{".": "job", "datasets": "dataset"}, path: "datasets/people.json", want: "dataset"},
+		{name: "outside the root directory", directories: map[string]string{".": "job"}, path: "../import.json", want: "unknown"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Project{Directories: tt.directories}
+			if got := p.configType(filepath.FromSlash(tt.path)); got != tt.want {
+				t.Errorf("configType(%q) = %q, want %q", tt.path, got, tt.want)
+			}
+		})
+	}
+}
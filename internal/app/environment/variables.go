@@ -0,0 +1,147 @@
+package environment
+
+import (
+	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// extendsKey names the env files an env file is based on, relative to the env file itself
+const extendsKey = "extends"
+
+// Variables are the merged variables of the env files, with the file each value came from
+type Variables struct {
+	Values map[string]interface{}
+	// Sources maps the dotted path of every value to the env file it was read from
+	Sources map[string]string
+}
+
+// LoadVariables merges the env files in order. Every env file is merged on top of the files it extends,
+// nested objects are merged key by key and any other value replaces the previous value.
+func (env *Environment) LoadVariables() (*Variables, error) {
+	variables := &Variables{Values: make(map[string]interface{}), Sources: make(map[string]string)}
+	for _, file := range env.EnvironmentFiles {
+		if err := variables.mergeFile(file, nil); err != nil {
+			return nil, err
+		}
+	}
+	return variables, nil
+}
+
+// mergeFile merges an env file and its bases into the variables, chain holds the files being merged to detect cycles
+func (v *Variables) mergeFile(file string, chain []string) error {
+	file = filepath.Clean(file)
+	for _, previous := range chain {
+		if previous == file {
+			return fmt.Errorf("env file '%s' extends itself through %s", file, strings.Join(append(chain, file), " -> "))
+		}
+	}
+	chain = append(chain, file)
+
+	content, err := utils.ReadJsonFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read env file '%s': %w", file, err)
+	}
+
+	var bases []string
+	switch extends := content[extendsKey].(type) {
+	case nil:
+	case string:
+		bases = append(bases, extends)
+	case []interface{}:
+		for _, base := range extends {
+			baseFile, ok := base.(string)
+			if !ok {
+				return fmt.Errorf("env file '%s' has an invalid '%s', expected a file name or a list of file names", file, extendsKey)
+			}
+			bases = append(bases, baseFile)
+		}
+	default:
+		return fmt.Errorf("env file '%s' has an invalid '%s', expected a file name or a list of file names", file, extendsKey)
+	}
+	for _, base := range bases {
+		if !filepath.IsAbs(base) {
+			base = filepath.Join(filepath.Dir(file), base)
+		}
+		if err := v.mergeFile(base, chain); err != nil {
+			return err
+		}
+	}
+
+	delete(content, extendsKey)
+	v.merge(v.Values, content, "", file)
+	return nil
+}
+
+func (v *Variables) merge(target map[string]interface{}, values map[string]interface{}, prefix string, file string) {
+	for key, value := range values {
+		path := prefix + key
+		valueMap, isMap := value.(map[string]interface{})
+		targetMap, targetIsMap := target[key].(map[string]interface{})
+		if isMap && targetIsMap {
+			v.merge(targetMap, valueMap, path+".", file)
+			continue
+		}
+		v.clearSources(path)
+		if isMap {
+			// copied, so merging a later file never changes the content of an earlier one
+			copied := make(map[string]interface{})
+			v.merge(copied, valueMap, path+".", file)
+			if len(valueMap) == 0 {
+				v.Sources[path] = file
+			}
+			target[key] = copied
+			continue
+		}
+		target[key] = value
+		v.Sources[path] = file
+	}
+}
+
+// clearSources removes the sources of a value that is replaced, including those of its nested values
+func (v *Variables) clearSources(path string) {
+	for source := range v.Sources {
+		if source == path || strings.HasPrefix(source, path+".") {
+			delete(v.Sources, source)
+		}
+	}
+}
+
+// Paths returns the dotted paths of all values in sorted order
+func (v *Variables) Paths() []string {
+	var paths []string
+	for path := range v.Sources {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Value returns the value at a dotted path
+func (v *Variables) Value(path string) interface{} {
+	var value interface{} = v.Values
+	for _, key := range strings.Split(path, ".") {
+		parent, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = parent[key]
+	}
+	return value
+}
+
+// Name returns the name of the environment being deployed. It is the 'environment' variable if it is set,
+// otherwise the name of the last env file without the 'variables-' prefix, so variables-prod.json is 'prod'.
+func (env *Environment) Name(variables map[string]interface{}) string {
+	if name, ok := variables["environment"].(string); ok && name != "" {
+		return name
+	}
+	if len(env.EnvironmentFiles) == 0 {
+		return ""
+	}
+	name := filepath.Base(env.EnvironmentFiles[len(env.EnvironmentFiles)-1])
+	name = strings.TrimSuffix(name, filepath.Ext(name))
+	return strings.TrimPrefix(name, "variables-")
+}
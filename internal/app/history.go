@@ -0,0 +1,360 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/datahub"
+	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
+	"github.com/pterm/pterm"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// historyDataset is the dataset the deployment records of every manifest are stored in
+const historyDataset = "DatahubConfigHistory"
+
+const historyNamespace = "http://data.mimiro.io/mim-deploy/history/"
+
+// deploymentRecord describes a single deployment, it is stored once and never changed
+type deploymentRecord struct {
+	Id         string             `json:"id"`
+	Manifest   string             `json:"manifest"`
+	Time       time.Time          `json:"time"`
+	Status     string             `json:"status"`
+	Error      string             `json:"error,omitempty"`
+	Commit     string             `json:"commit,omitempty"`
+	User       string             `json:"user"`
+	RunId      string             `json:"runId,omitempty"`
+	EnvFiles   []string           `json:"envFiles"`
+	RollbackTo string             `json:"rollbackTo,omitempty"`
+	Operations []historyOperation `json:"operations"`
+	// Configs and Transforms are the manifest and the javascript transforms by digest after a successful
+	// deployment, used to roll back to it
+	Configs    map[string]config `json:"configs,omitempty"`
+	Transforms map[string]string `json:"transforms,omitempty"`
+}
+
+// historyOperation is an operation of a deployment and what happened to it
+type historyOperation struct {
+	Action string `json:"action"`
+	Type   string `json:"type"`
+	Id     string `json:"id"`
+	Path   string `json:"path"`
+	// Result is executed, failed, rolled back or skipped
+	Result string `json:"result"`
+}
+
+// recordDeployment stores the record of a deployment of the manifest that executed the first executed operations,
+// and failed with err if it is not nil. Rollback is "rolled back" or "rollback failed" when the changes of a
+// failed deployment were rolled back. A deployment is not failed when its record can not be stored.
+func (app *App) recordDeployment(manifest Manifest, executed int, err error, rollback string) {
+	now := time.Now().UTC()
+	record := deploymentRecord{
+		Id:       fmt.Sprintf("%s-%s", app.Env.ManifestId, now.Format("20060102T150405.000Z")),
+		Manifest: app.Env.ManifestId,
+		Time:     now,
+		Status:   "succeeded",
+		Commit:   gitCommit(app.Env.RootPath),
+		User:     deployer(),
+		RunId:    ciRunId(),
+	}
+	for _, file := range app.Env.EnvironmentFiles {
+		record.EnvFiles = append(record.EnvFiles, filepath.Base(file))
+	}
+	if app.restoring != nil {
+		record.RollbackTo = app.restoring.Id
+		record.Commit = app.restoring.Commit
+		record.EnvFiles = app.restoring.EnvFiles
+	}
+	rolledBack := err != nil && rollback == "rolled back"
+	if err != nil {
+		record.Status = "failed"
+		if rollback != "" {
+			record.Status = rollback
+		}
+		// errors can contain the configs that failed, so secrets are masked before they are stored
+		record.Error = utils.Redact(err.Error())
+	}
+	for i, op := range manifest.Operations {
+		result := "executed"
+		if i == executed && err != nil {
+			result = "failed"
+		} else if i > executed && err != nil {
+			result = "skipped"
+		} else if rolledBack {
+			result = "rolled back"
+		}
+		record.Operations = append(record.Operations, historyOperation{
+			Action: op.Action,
+			Type:   op.Config.Type,
+			Id:     op.Config.Id,
+			Path:   op.ConfigPath,
+			Result: result,
+		})
+	}
+
+	if err == nil {
+		record.Configs = manifest.redacted().Manifest
+		record.Transforms = make(map[string]string)
+		for _, c := range record.Configs {
+			if !hasJSTransform(c.JsonContent) {
+				continue
+			}
+			_, code, err := app.readTransform(c)
+			if err != nil {
+				pterm.Warning.Printf("The transform of job '%s' is not stored in the history, it can not be rolled back to: %s\n", c.Id, err)
+				continue
+			}
+			record.Transforms[c.TransformDigest] = string(code)
+		}
+	}
+
+	if storeErr := app.storeRecord(record); storeErr != nil {
+		pterm.Warning.Printf("Failed to store the deployment in the history: %s\n", storeErr)
+	}
+}
+
+func (app *App) storeRecord(record deploymentRecord) error {
+	operations, err := json.Marshal(record.Operations)
+	if err != nil {
+		return err
+	}
+	configs, err := json.Marshal(record.Configs)
+	if err != nil {
+		return err
+	}
+	transforms, err := json.Marshal(record.Transforms)
+	if err != nil {
+		return err
+	}
+	entity := datahub.Entity{
+		Id: "ns0:" + record.Id,
+		Props: map[string]interface{}{
+			"ns0:manifest":   record.Manifest,
+			"ns0:time":       record.Time.Format(time.RFC3339Nano),
+			"ns0:status":     record.Status,
+			"ns0:error":      record.Error,
+			"ns0:commit":     record.Commit,
+			"ns0:user":       record.User,
+			"ns0:runId":      record.RunId,
+			"ns0:envFiles":   record.EnvFiles,
+			"ns0:rollbackTo": record.RollbackTo,
+			"ns0:operations": string(operations),
+			"ns0:configs":    string(configs),
+			"ns0:transforms": string(transforms),
+		},
+	}
+	context := datahub.Entity{Id: "@context", Namespaces: map[string]interface{}{"ns0": historyNamespace}}
+	payload, err := json.Marshal([]datahub.Entity{context, entity})
+	if err != nil {
+		return err
+	}
+	err = app.Client.StoreEntities(historyDataset, payload)
+	if datahub.IsNotFound(err) {
+		err = app.Client.CreateDataset(historyDataset, nil)
+		if err == nil {
+			err = app.Client.StoreEntities(historyDataset, payload)
+		}
+	}
+	return err
+}
+
+// readHistory returns the deployment records of the manifest, newest first
+func (app *App) readHistory() ([]deploymentRecord, error) {
+	entities, err := app.Client.GetEntities(historyDataset)
+	if datahub.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the deployment history: %w", err)
+	}
+	var records []deploymentRecord
+	for _, entity := range entities {
+		if entity.Id == "@context" || entity.Deleted {
+			continue
+		}
+		record := recordFromEntity(entity)
+		if record.Manifest == app.Env.ManifestId {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Time.After(records[j].Time)
+	})
+	return records, nil
+}
+
+// recordFromEntity reads a record from an entity, the namespace prefix of the properties is assigned by the datahub
+func recordFromEntity(entity datahub.Entity) deploymentRecord {
+	props := make(map[string]interface{})
+	for key, value := range entity.Props {
+		_, name, found := strings.Cut(key, ":")
+		if !found {
+			name = key
+		}
+		props[name] = value
+	}
+	str := func(name string) string {
+		value, _ := props[name].(string)
+		return value
+	}
+	_, id, _ := strings.Cut(entity.Id, ":")
+	record := deploymentRecord{
+		Id:         id,
+		Manifest:   str("manifest"),
+		Status:     str("status"),
+		Error:      str("error"),
+		Commit:     str("commit"),
+		User:       str("user"),
+		RunId:      str("runId"),
+		RollbackTo: str("rollbackTo"),
+	}
+	record.Time, _ = time.Parse(time.RFC3339Nano, str("time"))
+	if envFiles, ok := props["envFiles"].([]interface{}); ok {
+		for _, file := range envFiles {
+			record.EnvFiles = append(record.EnvFiles, fmt.Sprint(file))
+		}
+	}
+	_ = json.Unmarshal([]byte(str("operations")), &record.Operations)
+	_ = json.Unmarshal([]byte(str("configs")), &record.Configs)
+	_ = json.Unmarshal([]byte(str("transforms")), &record.Transforms)
+	return record
+}
+
+// getDeployment returns the record of a deployment of the manifest
+func (app *App) getDeployment(deploymentId string) (*deploymentRecord, error) {
+	records, err := app.readHistory()
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if record.Id == deploymentId {
+			return &record, nil
+		}
+	}
+	return nil, fmt.Errorf("no deployment '%s' found in the history of manifest '%s'", deploymentId, app.Env.ManifestId)
+}
+
+// History lists the latest deployments of the manifest, or the operations of a single deployment
+func (app *App) History(deploymentId string, limit int) error {
+	if deploymentId != "" {
+		record, err := app.getDeployment(deploymentId)
+		if err != nil {
+			return err
+		}
+		return app.printRecord(*record)
+	}
+
+	records, err := app.readHistory()
+	if err != nil {
+		return err
+	}
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+	if app.Env.EnableJsonOut {
+		// the stored manifests are only listed when a single deployment is shown
+		for i := range records {
+			records[i].Configs = nil
+			records[i].Transforms = nil
+		}
+		jsonRecords, err := json.Marshal(records)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(jsonRecords))
+		return nil
+	}
+	if len(records) == 0 {
+		pterm.Info.Printf("No deployments of manifest '%s' found\n", app.Env.ManifestId)
+		return nil
+	}
+	data := pterm.TableData{{"Deployment", "Status", "Commit", "User", "Run", "Env", "Operations"}}
+	for _, r := range records {
+		commit := r.Commit
+		if len(commit) > 8 {
+			commit = commit[:8]
+		}
+		status := r.Status
+		if r.RollbackTo != "" {
+			status += " (rollback)"
+		}
+		data = append(data, []string{r.Id, status, commit, r.User, r.RunId, strings.Join(r.EnvFiles, ", "), fmt.Sprint(len(r.Operations))})
+	}
+	return pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+}
+
+func (app *App) printRecord(record deploymentRecord) error {
+	if app.Env.EnableJsonOut {
+		jsonRecord, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(jsonRecord))
+		return nil
+	}
+	pterm.DefaultSection.Println(record.Id)
+	pterm.Printf("Status:  %s\n", record.Status)
+	if record.Error != "" {
+		pterm.Printf("Error:   %s\n", record.Error)
+	}
+	pterm.Printf("Time:    %s\n", record.Time.Format(time.RFC3339))
+	pterm.Printf("Commit:  %s\n", record.Commit)
+	pterm.Printf("User:    %s\n", record.User)
+	if record.RunId != "" {
+		pterm.Printf("Run:     %s\n", record.RunId)
+	}
+	if record.RollbackTo != "" {
+		pterm.Printf("Rollback to: %s\n", record.RollbackTo)
+	}
+	pterm.Printf("Env:     %s\n", strings.Join(record.EnvFiles, ", "))
+	pterm.Println()
+	if len(record.Operations) == 0 {
+		pterm.Println("No operations")
+		return nil
+	}
+	data := pterm.TableData{{"Action", "Type", "Id", "Path", "Result"}}
+	for _, op := range record.Operations {
+		data = append(data, []string{op.Action, op.Type, op.Id, op.Path, op.Result})
+	}
+	return pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+}
+
+// deployer names the user and host running the deployment
+func deployer() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s@%s", name, host)
+}
+
+// gitCommit returns the commit being deployed, from the ci environment or the git repository of the config
+func gitCommit(rootPath string) string {
+	for _, name := range []string{"GITHUB_SHA", "CI_COMMIT_SHA", "BUILD_SOURCEVERSION", "GIT_COMMIT"} {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	output, err := exec.Command("git", "-C", rootPath, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// ciRunId returns the id of the ci run executing the deployment, if any
+func ciRunId() string {
+	for _, name := range []string{"GITHUB_RUN_ID", "CI_PIPELINE_ID", "BUILD_BUILDID", "BUILD_ID"} {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
@@ -0,0 +1,213 @@
+package app
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/datahub"
+	"github.com/pterm/pterm"
+	"os"
+	"time"
+)
+
+// lockPollInterval is how often a held lock is checked while waiting for it
+const lockPollInterval = 2 * time.Second
+
+// lockSettleDelay is how long a written lock is left before it is read back, so that a deployment writing
+// its lock at the same time has written it too and only the last of them gets the lock
+var lockSettleDelay = lockPollInterval
+
+// registryLockTtl is how long the registry lock is held before it is stale, it is only held while the
+// registry is updated
+const registryLockTtl = time.Minute
+
+// manifestLock is a lease on a manifest, stored as content in the datahub next to the manifest.
+// A lock that is not released before it expires is stale, and is broken by the next deployment.
+type manifestLock struct {
+	Id       string    `json:"id"`
+	Manifest string    `json:"manifest"`
+	Owner    string    `json:"owner"`
+	Token    string    `json:"token"`
+	Acquired time.Time `json:"acquired"`
+	Expires  time.Time `json:"expires"`
+	// name is what is locked, for messages
+	name string
+}
+
+func (l *manifestLock) String() string {
+	if l == nil {
+		return "another deployment"
+	}
+	return fmt.Sprintf("%s since %s", l.Owner, l.Acquired.Format(time.RFC3339))
+}
+
+// lockId is the id of the content holding the lock of the manifest
+func (m *ManifestConfig) lockId() string {
+	return m.Env.ManifestId + "Lock"
+}
+
+// getLock reads a lock, a lock that is not held does not exist
+func (m *ManifestConfig) getLock(id string) (*manifestLock, error) {
+	output, err := m.Client.GetContent(id)
+	if datahub.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the lock '%s': %w", id, err)
+	}
+	lock := &manifestLock{}
+	if err := json.Unmarshal(output, lock); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the lock '%s': %w", id, err)
+	}
+	return lock, nil
+}
+
+// acquireLock locks the manifest, waiting up to the lock timeout for a lock held by another deployment.
+// Dry runs do not change the datahub, so they never lock.
+func (m *ManifestConfig) acquireLock() (*manifestLock, error) {
+	lock, err := m.acquire(m.lockId(), fmt.Sprintf("manifest '%s'", m.Env.ManifestId), m.Env.LockTtl)
+	if err != nil {
+		return nil, err
+	}
+	m.lock = lock
+	return lock, nil
+}
+
+// acquireRegistryLock locks the manifest registry, which is updated by the deployments of every manifest
+func (m *ManifestConfig) acquireRegistryLock() (*manifestLock, error) {
+	return m.acquire(manifestRegistryId+"Lock", "the manifest registry", registryLockTtl)
+}
+
+func (m *ManifestConfig) acquire(id string, name string, ttl time.Duration) (*manifestLock, error) {
+	if m.Env.DryRun {
+		return nil, nil
+	}
+	token, err := lockToken()
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(m.Env.LockTimeout)
+	waiting := false
+	for {
+		current, err := m.getLock(id)
+		if err != nil {
+			return nil, err
+		}
+		if current != nil && current.Token != token && time.Now().After(current.Expires) {
+			pterm.Warning.Printf("Breaking the stale lock of %s held by %s\n", name, current)
+			current = nil
+		}
+		if current == nil {
+			now := time.Now().UTC()
+			lock := &manifestLock{
+				Id:       id,
+				Manifest: m.Env.ManifestId,
+				Owner:    lockOwner(),
+				Token:    token,
+				Acquired: now,
+				Expires:  now.Add(ttl),
+				name:     name,
+			}
+			jsonLock, err := json.Marshal(lock)
+			if err != nil {
+				return nil, err
+			}
+			if err := m.Client.AddContent(jsonLock); err != nil {
+				return nil, fmt.Errorf("failed to lock %s: %w", name, err)
+			}
+			// the content store has no conditional writes, so the lock is read back to detect a deployment locking at
+			// the same time. A write arriving later than the settle delay can still take the lock from us, which is
+			// detected before the manifest is written and when the lock is released.
+			time.Sleep(lockSettleDelay)
+			current, err = m.getLock(id)
+			if err != nil {
+				return nil, err
+			}
+			if current != nil && current.Token == token {
+				return lock, nil
+			}
+		}
+		if !time.Now().Before(deadline) {
+			if id != m.lockId() {
+				return nil, fmt.Errorf("%s is locked by %s, retry later", name, current)
+			}
+			return nil, fmt.Errorf("%s is locked by %s, retry later or run 'manifest force-unlock' if the deployment is no longer running", name, current)
+		}
+		if !waiting {
+			pterm.Info.Printf("Waiting up to %s for the lock of %s held by %s\n", m.Env.LockTimeout, name, current)
+			waiting = true
+		}
+		time.Sleep(min(lockPollInterval, time.Until(deadline)))
+	}
+}
+
+// checkLock fails when the lock is no longer held, as another deployment may have run at the same time
+func (m *ManifestConfig) checkLock(lock *manifestLock) error {
+	current, err := m.getLock(lock.Id)
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		return fmt.Errorf("the lock of %s was removed during the deployment, another deployment may have run at the same time", lock.name)
+	}
+	if current.Token != lock.Token {
+		reason := "was taken"
+		if time.Now().After(lock.Expires) {
+			reason = "expired and was taken"
+		}
+		return fmt.Errorf("the lock of %s %s by %s during the deployment, another deployment may have run at the same time", lock.name, reason, current)
+	}
+	return nil
+}
+
+// releaseLock removes the lock. It fails without removing it when the lock was lost during the deployment.
+func (m *ManifestConfig) releaseLock(lock *manifestLock) error {
+	if lock == nil {
+		return nil
+	}
+	if m.lock == lock {
+		m.lock = nil
+	}
+	if err := m.checkLock(lock); err != nil {
+		return err
+	}
+	if err := m.Client.DeleteContent(lock.Id); err != nil {
+		return fmt.Errorf("failed to unlock %s: %w", lock.name, err)
+	}
+	return nil
+}
+
+// ForceUnlock removes the lock of the manifest, whoever holds it
+func (m *ManifestConfig) ForceUnlock() error {
+	current, err := m.getLock(m.lockId())
+	if err != nil {
+		return err
+	}
+	if current == nil {
+		pterm.Info.Printf("Manifest '%s' is not locked\n", m.Env.ManifestId)
+		return nil
+	}
+	if m.Env.DryRun {
+		pterm.Success.Printf("Dry run enabled. The lock held by %s would be removed, set flag --dry-run=false to remove it.\n", current)
+		return nil
+	}
+	if err := m.Client.DeleteContent(m.lockId()); err != nil {
+		return fmt.Errorf("failed to unlock manifest '%s': %w", m.Env.ManifestId, err)
+	}
+	pterm.Success.Printf("Removed the lock of manifest '%s' held by %s\n", m.Env.ManifestId, current)
+	return nil
+}
+
+// lockOwner describes the deployment holding a lock, for the messages of deployments waiting for it
+func lockOwner() string {
+	return fmt.Sprintf("%s (pid %d)", deployer(), os.Getpid())
+}
+
+func lockToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,133 @@
+package app
+
+import (
+	"encoding/json"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/datahub"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/environment"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// contentClient keeps content in memory. afterAdd is called after every write, to let another
+// deployment write at the same time.
+type contentClient struct {
+	datahub.Client
+	content  map[string][]byte
+	afterAdd func(id string)
+}
+
+func (c *contentClient) GetContent(id string) ([]byte, error) {
+	content, ok := c.content[id]
+	if !ok {
+		return nil, &datahub.Error{StatusCode: http.StatusNotFound, Operation: "get content " + id}
+	}
+	return content, nil
+}
+
+func (c *contentClient) AddContent(content []byte) error {
+	var payload struct {
+		Id string `json:"id"`
+	}
+	if err := json.Unmarshal(content, &payload); err != nil {
+		return err
+	}
+	c.content[payload.Id] = content
+	if c.afterAdd != nil {
+		afterAdd := c.afterAdd
+		c.afterAdd = nil
+		afterAdd(payload.Id)
+	}
+	return nil
+}
+
+func (c *contentClient) DeleteContent(id string) error {
+	delete(c.content, id)
+	return nil
+}
+
+// takeLock writes the lock of another deployment
+func (c *contentClient) takeLock(id string) {
+	lock, _ := json.Marshal(manifestLock{Id: id, Owner: "other", Token: "other", Expires: time.Now().Add(time.Hour)})
+	c.content[id] = lock
+}
+
+func newLockTest(t *testing.T) (*ManifestConfig, *contentClient) {
+	settleDelay := lockSettleDelay
+	lockSettleDelay = 0
+	t.Cleanup(func() { lockSettleDelay = settleDelay })
+	client := &contentClient{content: make(map[string][]byte)}
+	env := &environment.Environment{ManifestId: "test", LockTtl: time.Hour}
+	return NewManifest(env, client), client
+}
+
+func TestLock(t *testing.T) {
+	tests := []struct {
+		name string
+		// during runs while the lock is held, and returns the error expected when the lock is released
+		during  func(m *ManifestConfig, client *contentClient) string
+		release string
+	}{
+		{
+			name:   "released",
+			during: func(m *ManifestConfig, client *contentClient) string { return "" },
+		},
+		{
+			name: "taken by another deployment",
+			during: func(m *ManifestConfig, client *contentClient) string {
+				client.takeLock(m.lockId())
+				return "was taken by other"
+			},
+		},
+		{
+			name: "removed",
+			during: func(m *ManifestConfig, client *contentClient) string {
+				delete(client.content, m.lockId())
+				return "was removed"
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, client := newLockTest(t)
+			lock, err := m.acquireLock()
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := tt.during(m, client)
+			writeErr := m.writeManifestToDatahub(`{"id": "test"}`)
+			err = m.releaseLock(lock)
+			if want == "" {
+				if writeErr != nil || err != nil {
+					t.Fatalf("writing the manifest and releasing the lock failed: %v, %v", writeErr, err)
+				}
+				if _, exists := client.content[m.lockId()]; exists {
+					t.Fatal("the lock was not removed")
+				}
+				return
+			}
+			if writeErr == nil || !strings.Contains(writeErr.Error(), want) {
+				t.Errorf("writing the manifest = %v, want an error containing %q", writeErr, want)
+			}
+			if err == nil || !strings.Contains(err.Error(), want) {
+				t.Errorf("releaseLock() = %v, want an error containing %q", err, want)
+			}
+		})
+	}
+}
+
+func TestAcquireLockRace(t *testing.T) {
+	m, client := newLockTest(t)
+	// another deployment writes its lock right after ours, before ours is read back
+	client.afterAdd = func(id string) {
+		client.takeLock(id)
+	}
+	_, err := m.acquireLock()
+	if err == nil || !strings.Contains(err.Error(), "is locked by other") {
+		t.Fatalf("acquireLock() = %v, want the lock held by the other deployment", err)
+	}
+	if m.lock != nil {
+		t.Error("a lock that was not acquired is kept")
+	}
+}
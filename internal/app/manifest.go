@@ -4,24 +4,30 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/datahub"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/diff"
 	"github.com/mimiro-io/datahub-config-deployment/internal/app/environment"
 	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
 	"github.com/pterm/pterm"
-	"io/ioutil"
+	"github.com/tidwall/pretty"
 	"os"
-	"os/exec"
-	"strings"
 )
 
 type ManifestConfig struct {
-	Env *environment.Environment
+	Env    *environment.Environment
+	Client datahub.Client
+	// lock is the manifest lock held by the deployment, it must still be held when the manifest is written
+	lock *manifestLock
 }
 
 type Manifest struct {
 	Id         string            `json:"id"`
 	Manifest   map[string]config `json:"manifest"`
 	Operations []operation       `json:"operations"`
+	// Transforms is the code of the javascript transforms of the jobs, by transform digest
+	Transforms map[string]manifestTransform `json:"transforms,omitempty"`
 }
 
 type config struct {
@@ -32,25 +38,46 @@ type config struct {
 	Type            string                 `json:"type"`
 	JsonContent     map[string]interface{} `json:"jsonContent"`
 	TransformDigest string                 `json:"transformDigest"`
+	// Line and Col are the position of the id in the config file, used to annotate errors
+	Line int `json:"line,omitempty"`
+	Col  int `json:"col,omitempty"`
 }
 
 type operation struct {
-	Config         config `json:"config"`
-	ConfigPath     string `json:"configPath"`
-	Action         string `json:"action"`
-	HasJSTransform bool   `json:"hasJSTransform"`
+	Config         config      `json:"config"`
+	ConfigPath     string      `json:"configPath"`
+	Action         string      `json:"action"`
+	HasJSTransform bool        `json:"hasJSTransform"`
+	Diff           *configDiff `json:"diff,omitempty"`
 }
 
-func NewManifest(env *environment.Environment) *ManifestConfig {
-	return &ManifestConfig{Env: env}
+// configDiff describes what an update operation changes in a config and its transform
+type configDiff struct {
+	Changes       []diff.Change `json:"changes,omitempty"`
+	TransformDiff string        `json:"transformDiff,omitempty"`
+	// SecretChanged is set when only a redacted value changed, which the redacted changes cannot show
+	SecretChanged bool `json:"secretChanged,omitempty"`
 }
 
-func hasJSTransform(JsonContent map[string]interface{}) bool {
-	value, exist := JsonContent["transform"]
-	if exist {
-		value = value.(map[string]interface{})["Type"].(string)
+// withoutDiffs returns a copy of the manifest where the operations have no diffs
+func (m Manifest) withoutDiffs() Manifest {
+	operations := make([]operation, len(m.Operations))
+	for i, op := range m.Operations {
+		op.Diff = nil
+		operations[i] = op
 	}
-	return exist && value == "JavascriptTransform"
+	m.Operations = operations
+	return m
+}
+
+func NewManifest(env *environment.Environment, client datahub.Client) *ManifestConfig {
+	return &ManifestConfig{Env: env, Client: client}
+}
+
+func hasJSTransform(JsonContent map[string]interface{}) bool {
+	transform, _ := JsonContent["transform"].(map[string]interface{})
+	transformType, _ := transform["Type"].(string)
+	return transformType == "JavascriptTransform"
 }
 
 func determineSinkDataset(jsonContent map[string]interface{}) string {
@@ -72,17 +99,6 @@ func getPublicNamespaces(jsonContent map[string]interface{}) []string {
 	return namespaces
 }
 
-func getTransformDigest(path string) (string, error) {
-	fileBytes, err := utils.ReadFile(path)
-	if err != nil {
-		return "", err
-	}
-	hasher := md5.New()
-	hasher.Write(fileBytes)
-	hash := hex.EncodeToString(hasher.Sum(nil))
-	return hash, nil
-}
-
 func createDigest(jsonContent map[string]interface{}) (string, error) {
 	// create md5 hash
 	b, err := json.Marshal(jsonContent)
@@ -96,54 +112,119 @@ func createDigest(jsonContent map[string]interface{}) (string, error) {
 }
 
 func (m *ManifestConfig) getManifestFromDatahub() (*Manifest, error) {
-	args := []string{
-		"mim", "content", "show", "DatahubConfigManifest", "--json",
+	manifest, err := m.getManifest(m.Env.ManifestId)
+	if err != nil && !datahub.IsNotFound(err) {
+		pterm.Error.Println("Request to get manifest from datahub failed with error: ", err)
 	}
+	if err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
 
-	utils.LogCommand(args, "default", "")
-
-	cmdMim := exec.Command("/bin/bash", "-c", fmt.Sprintf("%s", strings.Join(args, " ")))
-	output, err := cmdMim.CombinedOutput()
+// getManifest reads the manifest with the id from the datahub
+func (m *ManifestConfig) getManifest(id string) (*Manifest, error) {
+	output, err := m.Client.GetContent(id)
 	if err != nil {
-		pterm.Error.Println("Command to get manifest from datahub failed with error: ", string(output), err)
 		return nil, err
 	}
 	manifest := &Manifest{}
 	err = json.Unmarshal(output, manifest)
 	if err != nil {
-		fmt.Println("Failed to unmarshal manifest: ", err)
-		return nil, err
+		return nil, fmt.Errorf("failed to unmarshal manifest '%s': %w", id, err)
 	}
-	return manifest, err
+	return manifest, nil
 }
 
 func (m *ManifestConfig) writeManifestToDatahub(input string) error {
-
-	// Create temp file with string payload
-	tmpFileName := "tmp.json"
-	d1 := []byte(input)
-	err := ioutil.WriteFile(tmpFileName, d1, 0644)
+	if m.lock != nil {
+		if err := m.checkLock(m.lock); err != nil {
+			return fmt.Errorf("refusing to write the manifest: %w", err)
+		}
+	}
+	err := m.Client.AddContent([]byte(input))
 	if err != nil {
+		pterm.Warning.Println("Failed to write manifest to datahub: ", err)
 		return err
 	}
+	return nil
+}
 
-	args := []string{
-		"mim", "content", "add", "--file=tmp.json",
+// ShowManifest prints the manifest stored in the datahub
+func (m *ManifestConfig) ShowManifest() error {
+	manifest, err := m.readManifest()
+	if err != nil {
+		return err
+	}
+	if m.Env.EnableJsonOut {
+		fmt.Println(string(manifest))
+		return nil
 	}
+	pterm.Println(string(pretty.Color(pretty.Pretty(manifest), nil)))
+	return nil
+}
 
-	cmdMim := exec.Command("/bin/bash", "-c", fmt.Sprintf("%s", strings.Join(args, " ")))
-	if err := cmdMim.Run(); err != nil {
-		pterm.Warning.Println("Failed to write manifest to datahub: ", err)
+// ExportManifest writes the manifest stored in the datahub to a file
+func (m *ManifestConfig) ExportManifest(file string) error {
+	manifest, err := m.readManifest()
+	if err != nil {
 		return err
 	}
+	err = os.WriteFile(file, pretty.Pretty(manifest), 0644)
+	if err != nil {
+		return err
+	}
+	pterm.Success.Printf("Manifest exported to %s\n", file)
+	return nil
+}
 
-	// Remove temp file
-	err = os.Remove(tmpFileName)
+// ImportManifest replaces the manifest in the datahub with the manifest in a file
+func (m *ManifestConfig) ImportManifest(file string) error {
+	fileBytes, err := utils.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	manifest := &Manifest{}
+	if err := json.Unmarshal(fileBytes, manifest); err != nil {
+		return fmt.Errorf("failed to read manifest from '%s': %w", file, err)
+	}
+	if manifest.Id != m.Env.ManifestId {
+		return fmt.Errorf("'%s' is not the manifest, expected id '%s' but found '%s'", file, m.Env.ManifestId, manifest.Id)
+	}
+	jsonManifest, err := json.Marshal(manifest)
 	if err != nil {
 		return err
 	}
+	if m.Env.DryRun {
+		pterm.Success.Printf("Dry run enabled. The manifest with %d configs would be imported, set flag --dry-run=false to import it.\n", len(manifest.Manifest))
+		return nil
+	}
+	lock, err := m.acquireLock()
+	if err != nil {
+		return err
+	}
+	err = m.importLocked(manifest, jsonManifest)
+	if err == nil {
+		pterm.Success.Printf("Manifest with %d configs imported from %s\n", len(manifest.Manifest), file)
+	}
+	return errors.Join(err, m.releaseLock(lock))
+}
 
-	return nil
+// importLocked writes the imported manifest, the manifest must be locked
+func (m *ManifestConfig) importLocked(manifest *Manifest, jsonManifest []byte) error {
+	if err := m.writeManifestToDatahub(string(jsonManifest)); err != nil {
+		return err
+	}
+	return m.register()
+}
+
+// readManifest returns the raw manifest stored in the datahub
+func (m *ManifestConfig) readManifest() ([]byte, error) {
+	manifest, err := m.Client.GetContent(m.Env.ManifestId)
+	if datahub.IsNotFound(err) {
+		return nil, fmt.Errorf("no manifest '%s' found in the datahub", m.Env.ManifestId)
+	}
+	return manifest, err
 }
 
 func diffManifest(previousManifest *Manifest, currentManifest Manifest) []operation {
@@ -171,6 +252,12 @@ func diffManifest(previousManifest *Manifest, currentManifest Manifest) []operat
 				Action:         action,
 				HasJSTransform: hasJSTransform,
 			}
+			if action == "update" {
+				// the previous config is redacted in the stored manifest, so the changes are as well
+				redacted := redactContent(config.JsonContent)
+				op.Diff = &configDiff{Changes: diff.Json(previous.JsonContent, redacted)}
+				op.Diff.SecretChanged = previous.Digest != config.Digest && len(op.Diff.Changes) == 0 && hasRedactedValues(redacted)
+			}
 			operations = append(operations, op)
 		}
 	}
@@ -0,0 +1,222 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/datahub"
+	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
+	"github.com/pterm/pterm"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// defaultManifestId is the manifest used when no manifest id is given. Manifests written before the
+// registry existed use this id, so it is always checked for ownership.
+const defaultManifestId = "DatahubConfigManifest"
+
+// manifestRegistryId is the id of the content listing every manifest deployed to the datahub
+const manifestRegistryId = "DatahubConfigManifests"
+
+type manifestRegistry struct {
+	Id        string   `json:"id"`
+	Manifests []string `json:"manifests"`
+}
+
+// configOwners is a config and the manifests owning it
+type configOwners struct {
+	Type      string   `json:"type"`
+	Id        string   `json:"id"`
+	Manifests []string `json:"manifests"`
+}
+
+// ownerKey identifies a config across manifests
+func ownerKey(c config) string {
+	return c.Type + "/" + c.Id
+}
+
+// getRegistry reads the manifest registry, a missing registry has no manifests
+func (m *ManifestConfig) getRegistry() (*manifestRegistry, error) {
+	registry := &manifestRegistry{Id: manifestRegistryId}
+	output, err := m.Client.GetContent(manifestRegistryId)
+	if datahub.IsNotFound(err) {
+		return registry, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the manifest registry: %w", err)
+	}
+	if err := json.Unmarshal(output, registry); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal the manifest registry: %w", err)
+	}
+	return registry, nil
+}
+
+// register adds the manifest being deployed to the registry, so other manifests know the configs it owns.
+// The registry is locked while it is updated, so manifests registering at the same time are all kept.
+func (m *ManifestConfig) register() error {
+	registry, err := m.getRegistry()
+	if err != nil {
+		return err
+	}
+	if slices.Contains(registry.Manifests, m.Env.ManifestId) {
+		return nil
+	}
+	lock, err := m.acquireRegistryLock()
+	if err != nil {
+		return err
+	}
+	err = m.registerLocked()
+	return errors.Join(err, m.releaseLock(lock))
+}
+
+// registerLocked reads the registry again under the lock, and adds the manifest if it is still missing
+func (m *ManifestConfig) registerLocked() error {
+	registry, err := m.getRegistry()
+	if err != nil {
+		return err
+	}
+	if slices.Contains(registry.Manifests, m.Env.ManifestId) {
+		return nil
+	}
+	registry.Manifests = append(registry.Manifests, m.Env.ManifestId)
+	sort.Strings(registry.Manifests)
+	jsonRegistry, err := json.Marshal(registry)
+	if err != nil {
+		return err
+	}
+	if err := m.Client.AddContent(jsonRegistry); err != nil {
+		return fmt.Errorf("failed to register manifest '%s': %w", m.Env.ManifestId, err)
+	}
+	return nil
+}
+
+// manifestIds returns the ids of every known manifest, sorted
+func (m *ManifestConfig) manifestIds() ([]string, error) {
+	registry, err := m.getRegistry()
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{defaultManifestId}
+	for _, id := range append([]string{m.Env.ManifestId}, registry.Manifests...) {
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// owners returns the manifests owning each config, by owner key. Manifests in the registry that
+// no longer exist in the datahub are skipped.
+func (m *ManifestConfig) owners(manifestIds []string) (map[string][]string, error) {
+	owners := make(map[string][]string)
+	for _, id := range manifestIds {
+		manifest, err := m.getManifest(id)
+		if datahub.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range manifest.Manifest {
+			owners[ownerKey(c)] = append(owners[ownerKey(c)], id)
+		}
+	}
+	return owners, nil
+}
+
+// checkOwnership refuses to add or update configs owned by another manifest, and leaves out deletes
+// of configs another manifest also owns
+func (app *App) checkOwnership(operations []operation) ([]operation, error) {
+	ids, err := app.M.manifestIds()
+	if err != nil {
+		return nil, err
+	}
+	var others []string
+	for _, id := range ids {
+		if id != app.Env.ManifestId {
+			others = append(others, id)
+		}
+	}
+	owners, err := app.M.owners(others)
+	if err != nil {
+		return nil, err
+	}
+
+	var allowed []operation
+	var problems []utils.ErrorDetails
+	for _, op := range operations {
+		otherOwners := owners[ownerKey(op.Config)]
+		if len(otherOwners) == 0 {
+			allowed = append(allowed, op)
+			continue
+		}
+		if op.Action == "delete" {
+			pterm.Warning.Printf("Not deleting %s '%s', it is owned by the manifest %s\n", op.Config.Type, op.Config.Id, strings.Join(otherOwners, ", "))
+			continue
+		}
+		problems = append(problems, utils.ErrorDetails{
+			File:    op.Config.Path,
+			Line:    op.Config.Line,
+			Col:     op.Config.Col,
+			Message: fmt.Sprintf("The %s '%s' is owned by the manifest %s", op.Config.Type, op.Config.Id, strings.Join(otherOwners, ", ")),
+		})
+	}
+	for _, problem := range problems {
+		utils.LogError(problem, app.Env.LogFormat)
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("deployment refused, %d configs are owned by other manifests", len(problems))
+	}
+	return allowed, nil
+}
+
+// ShowOwners prints the manifest owning every config in the datahub, and the configs owned by more than one
+func (m *ManifestConfig) ShowOwners() error {
+	ids, err := m.manifestIds()
+	if err != nil {
+		return err
+	}
+	owners, err := m.owners(ids)
+	if err != nil {
+		return err
+	}
+
+	var report []configOwners
+	for key, manifests := range owners {
+		configType, id, _ := strings.Cut(key, "/")
+		report = append(report, configOwners{Type: configType, Id: id, Manifests: manifests})
+	}
+	sort.Slice(report, func(i, j int) bool {
+		if report[i].Type != report[j].Type {
+			return report[i].Type < report[j].Type
+		}
+		return report[i].Id < report[j].Id
+	})
+
+	if m.Env.EnableJsonOut {
+		jsonReport, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(jsonReport))
+		return nil
+	}
+
+	shared := 0
+	data := pterm.TableData{{"Type", "Id", "Manifest"}}
+	for _, r := range report {
+		if len(r.Manifests) > 1 {
+			shared++
+		}
+		data = append(data, []string{r.Type, r.Id, strings.Join(r.Manifests, ", ")})
+	}
+	if err := pterm.DefaultTable.WithHasHeader().WithData(data).Render(); err != nil {
+		return err
+	}
+	if shared > 0 {
+		pterm.Warning.Printf("%d configs are owned by more than one manifest\n", shared)
+	}
+	return nil
+}
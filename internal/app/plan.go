@@ -0,0 +1,265 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/datahub"
+	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
+	"github.com/pterm/pterm"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const planVersion = 2
+
+// Plan is the list of operations computed from the config files and the manifest in the datahub.
+// A saved plan can be applied later, as long as the manifest in the datahub has not changed.
+type Plan struct {
+	Version            int       `json:"version"`
+	Created            time.Time `json:"created"`
+	Datahub            string    `json:"datahub"`
+	BaseManifestDigest string    `json:"baseManifestDigest"`
+	Manifest           Manifest  `json:"manifest"`
+}
+
+// createPlan reads the config files and diffs them against the manifest in the datahub.
+// It returns no plan if the manifest is missing and should not be created.
+func (app *App) createPlan() (*Plan, error) {
+	fileConfigs, err := app.readConfigs()
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.Connect()
+	if err != nil {
+		return nil, err
+	}
+
+	currentManifest := Manifest{
+		Id:       app.Env.ManifestId,
+		Manifest: fileConfigs,
+	}
+
+	previousManifest, err := app.M.getManifestFromDatahub()
+	if datahub.IsNotFound(err) {
+		if !app.Env.CreateManifestIfMissing {
+			return nil, nil
+		}
+		pterm.Warning.Println("No manifest found in the datahub. Assuming first run.")
+		previousManifest = new(Manifest) // To avoid empty pointer in diff
+	} else if err != nil {
+		// any other error must not be taken for a first run, which would add every config and delete none
+		return nil, err
+	}
+
+	operations, err := app.checkOwnership(diffManifest(previousManifest, currentManifest))
+	if err != nil {
+		return nil, err
+	}
+	operations = orderOperations(operations)
+	app.addTransformDiffs(previousManifest, operations)
+	currentManifest.Operations = operations
+	currentManifest.Transforms, err = app.manifestTransforms(fileConfigs)
+	if err != nil {
+		return nil, err
+	}
+
+	baseDigest, err := manifestDigest(previousManifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Plan{
+		Version:            planVersion,
+		Created:            time.Now().UTC(),
+		Datahub:            app.Env.MimServer,
+		BaseManifestDigest: baseDigest,
+		Manifest:           currentManifest,
+	}, nil
+}
+
+// manifestDigest digests the configs of a manifest, an empty or missing manifest has an empty digest
+func manifestDigest(manifest *Manifest) (string, error) {
+	if manifest == nil || len(manifest.Manifest) == 0 {
+		return "", nil
+	}
+	digests := make(map[string]interface{})
+	for key, c := range manifest.Manifest {
+		digests[key] = c.Digest + c.TransformDigest
+	}
+	return createDigest(digests)
+}
+
+// WritePlan computes the plan and writes it to the plan file without changing the datahub
+func (app *App) WritePlan(planFile string) error {
+	plan, err := app.createPlan()
+	if err != nil {
+		return err
+	}
+	if plan == nil {
+		return fmt.Errorf("no manifest found in the datahub, enable --create-manifest to plan a first deployment")
+	}
+
+	app.printPlan(plan)
+	app.printDiffs(plan.Manifest.Operations)
+
+	// plan files are shared for review, so secrets are redacted and resolved again when the plan is applied
+	plan.Manifest = plan.Manifest.redacted()
+	jsonPlan, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(planFile), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.WriteFile(planFile, jsonPlan, 0644); err != nil {
+		return err
+	}
+	pterm.Success.Printf("Plan with %d operations written to %s. Run apply with this plan file to execute it.\n", len(plan.Manifest.Operations), planFile)
+	return nil
+}
+
+// Diff shows the operations and changes a deployment would make, without writing a plan file
+func (app *App) Diff() error {
+	plan, err := app.createPlan()
+	if err != nil {
+		return err
+	}
+	if plan == nil {
+		return fmt.Errorf("no manifest found in the datahub, enable --create-manifest to diff a first deployment")
+	}
+	if app.Env.EnableJsonOut {
+		jsonOperations, err := json.Marshal(plan.Manifest.redacted().Operations)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(jsonOperations))
+		return nil
+	}
+	app.printPlan(plan)
+	app.printDiffs(plan.Manifest.Operations)
+	return nil
+}
+
+// ApplyPlan executes a saved plan, refusing to do so if the manifest in the datahub changed since it was made
+func (app *App) ApplyPlan(planFile string) error {
+	planBytes, err := utils.ReadFile(planFile)
+	if err != nil {
+		return err
+	}
+	plan := &Plan{}
+	if err := json.Unmarshal(planBytes, plan); err != nil {
+		return fmt.Errorf("failed to read plan file '%s': %w", planFile, err)
+	}
+	if plan.Version != planVersion {
+		return fmt.Errorf("plan file '%s' has version %d, expected %d", planFile, plan.Version, planVersion)
+	}
+	if !sameDatahub(plan.Datahub, app.Env.MimServer) {
+		return fmt.Errorf("plan was made for datahub '%s' and can not be applied to '%s'", plan.Datahub, app.Env.MimServer)
+	}
+	if plan.Manifest.Id != app.Env.ManifestId {
+		return fmt.Errorf("plan was made for manifest '%s' and can not be applied to '%s'", plan.Manifest.Id, app.Env.ManifestId)
+	}
+
+	err = app.Connect()
+	if err != nil {
+		return err
+	}
+	lock, err := app.M.acquireLock()
+	if err != nil {
+		return err
+	}
+	err = app.applyLocked(plan)
+	return errors.Join(err, app.M.releaseLock(lock))
+}
+
+// sameDatahub compares two datahub urls, ignoring the case of the scheme and host and a trailing slash
+func sameDatahub(a, b string) bool {
+	return normaliseDatahub(a) == normaliseDatahub(b)
+}
+
+func normaliseDatahub(server string) string {
+	u, err := url.Parse(strings.TrimSpace(server))
+	if err != nil {
+		return strings.TrimSuffix(server, "/")
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return u.String()
+}
+
+// applyLocked checks that the plan is still valid and applies it, the manifest must be locked
+func (app *App) applyLocked(plan *Plan) error {
+	remoteManifest, err := app.M.getManifestFromDatahub()
+	if datahub.IsNotFound(err) {
+		remoteManifest = nil
+	} else if err != nil {
+		return err
+	}
+	remoteDigest, err := manifestDigest(remoteManifest)
+	if err != nil {
+		return err
+	}
+	if remoteDigest != plan.BaseManifestDigest {
+		return fmt.Errorf("the manifest in the datahub changed after the plan was made on %s, create a new plan", plan.Created.Format(time.RFC3339))
+	}
+
+	if err := app.resolveSecrets(plan); err != nil {
+		return err
+	}
+
+	pterm.Info.Printf("Applying plan from %s with %d operations\n", plan.Created.Format(time.RFC3339), len(plan.Manifest.Operations))
+	return app.applyPlan(plan)
+}
+
+// resolveSecrets replaces the redacted configs of the plan with the configs read from the config files, which must
+// be unchanged since the plan was made. The digest of a config covers its secrets, so changed secrets are detected as well.
+func (app *App) resolveSecrets(plan *Plan) error {
+	var redacted []int
+	for i, op := range plan.Manifest.Operations {
+		if op.Action != "delete" && hasRedactedValues(op.Config.JsonContent) {
+			redacted = append(redacted, i)
+		}
+	}
+	if len(redacted) == 0 {
+		return nil
+	}
+	fileConfigs, err := app.readConfigs()
+	if err != nil {
+		return fmt.Errorf("failed to read the config files to resolve the secrets of the plan: %w", err)
+	}
+	for _, i := range redacted {
+		planned := plan.Manifest.Operations[i].Config
+		fileConfig, exists := fileConfigs[planned.Id]
+		if !exists || fileConfig.Type != planned.Type || fileConfig.Digest != planned.Digest {
+			return fmt.Errorf("the %s '%s' holds secrets and changed after the plan was made, create a new plan", planned.Type, planned.Id)
+		}
+		plan.Manifest.Operations[i].Config.JsonContent = fileConfig.JsonContent
+	}
+	return nil
+}
+
+func (app *App) printPlan(plan *Plan) {
+	operations := plan.Manifest.Operations
+	pterm.Println()
+	if len(operations) == 0 {
+		utils.LogPlain("No changes. The datahub is up to date with the config files.", app.Env.LogFormat)
+		return
+	}
+	if app.Env.LogFormat == "github" {
+		for _, op := range operations {
+			utils.LogPlain(fmt.Sprintf("%s %s '%s' (%s)", op.Action, op.Config.Type, op.Config.Id, op.ConfigPath), app.Env.LogFormat)
+		}
+		return
+	}
+	data := pterm.TableData{{"Action", "Type", "Id", "Path"}}
+	for _, op := range operations {
+		data = append(data, []string{op.Action, op.Config.Type, op.Config.Id, op.ConfigPath})
+	}
+	_ = pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+}
@@ -0,0 +1,121 @@
+package app
+
+import (
+	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
+	"strings"
+)
+
+const redactedValue = "[redacted]"
+
+// redactValue replaces a string holding a secret with a fixed marker. A digest of the value could be guessed
+// for short secrets, so a changed secret is only detected by the digest of the config.
+func redactValue(value string) string {
+	return redactedValue
+}
+
+// isRedacted also accepts the "[redacted:<sha256>]" values of manifests stored by earlier versions
+func isRedacted(value string) bool {
+	return value == redactedValue || strings.HasPrefix(value, "[redacted:") && strings.HasSuffix(value, "]")
+}
+
+// redactContent returns a copy of the json content where every string holding a secret is redacted
+func redactContent(content map[string]interface{}) map[string]interface{} {
+	redacted, _ := redactJson(content).(map[string]interface{})
+	return redacted
+}
+
+func redactJson(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, child := range v {
+			result[key] = redactJson(child)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, child := range v {
+			result[i] = redactJson(child)
+		}
+		return result
+	case string:
+		if utils.ContainsSecret(v) {
+			return redactValue(v)
+		}
+	}
+	return value
+}
+
+// hasRedactedValues returns true if secrets were removed from the json content
+func hasRedactedValues(value interface{}) bool {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for _, child := range v {
+			if hasRedactedValues(child) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, child := range v {
+			if hasRedactedValues(child) {
+				return true
+			}
+		}
+	case string:
+		return isRedacted(v)
+	}
+	return false
+}
+
+// redactLike redacts the strings in remote that are redacted at the same place in local,
+// so that a live config can be compared with the redacted config in the manifest
+func redactLike(local interface{}, remote interface{}) interface{} {
+	switch l := local.(type) {
+	case map[string]interface{}:
+		r, ok := remote.(map[string]interface{})
+		if !ok {
+			return remote
+		}
+		result := make(map[string]interface{}, len(r))
+		for key, child := range r {
+			result[key] = redactLike(l[key], child)
+		}
+		return result
+	case []interface{}:
+		r, ok := remote.([]interface{})
+		if !ok {
+			return remote
+		}
+		result := make([]interface{}, len(r))
+		for i, child := range r {
+			if i < len(l) {
+				result[i] = redactLike(l[i], child)
+			} else {
+				result[i] = child
+			}
+		}
+		return result
+	case string:
+		if r, ok := remote.(string); ok && isRedacted(l) {
+			return redactValue(r)
+		}
+	}
+	return remote
+}
+
+// redacted returns a copy of the manifest without secrets, for storing and printing it
+func (m Manifest) redacted() Manifest {
+	configs := make(map[string]config, len(m.Manifest))
+	for key, c := range m.Manifest {
+		c.JsonContent = redactContent(c.JsonContent)
+		configs[key] = c
+	}
+	operations := make([]operation, len(m.Operations))
+	for i, op := range m.Operations {
+		op.Config.JsonContent = redactContent(op.Config.JsonContent)
+		operations[i] = op
+	}
+	m.Manifest = configs
+	m.Operations = operations
+	return m
+}
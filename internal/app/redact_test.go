@@ -0,0 +1,45 @@
+package app
+
+import (
+	"encoding/json"
+	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
+	"strings"
+	"testing"
+)
+
+func TestDiffManifestRedactsSecrets(t *testing.T) {
+	utils.RegisterSecret("old-password-42", "")
+	utils.RegisterSecret("new-password-42", "")
+	fileConfig := func(password string, batchSize float64) config {
+		content := map[string]interface{}{"id": "import", "type": "job", "batchSize": batchSize, "password": password}
+		digest, _ := createDigest(content)
+		return config{Id: "import", Type: "job", JsonContent: content, Digest: digest}
+	}
+	stored := Manifest{Manifest: map[string]config{"import": fileConfig("old-password-42", 10)}}.redacted()
+	tests := []struct {
+		name          string
+		current       config
+		changes       int
+		secretChanged bool
+	}{
+		{name: "only the secret changed", current: fileConfig("new-password-42", 10), secretChanged: true},
+		{name: "secret and value changed", current: fileConfig("new-password-42", 20), changes: 1},
+		{name: "value changed", current: fileConfig("old-password-42", 20), changes: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			operations := diffManifest(&stored, Manifest{Manifest: map[string]config{"import": tt.current}})
+			if len(operations) != 1 || operations[0].Action != "update" {
+				t.Fatalf("diffManifest() = %v, want one update", operations)
+			}
+			d := operations[0].Diff
+			if len(d.Changes) != tt.changes || d.SecretChanged != tt.secretChanged {
+				t.Errorf("diff = %+v, want %d changes and secretChanged %v", d, tt.changes, tt.secretChanged)
+			}
+			jsonManifest, _ := json.Marshal(Manifest{Manifest: map[string]config{"import": tt.current}, Operations: operations}.redacted())
+			if strings.Contains(string(jsonManifest), "password-42") {
+				t.Errorf("the stored manifest holds the secret: %s", jsonManifest)
+			}
+		})
+	}
+}
@@ -0,0 +1,225 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/schema"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/templating"
+	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
+	"github.com/pterm/pterm"
+	"github.com/tidwall/pretty"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Render prints the templated version of the config files, without connecting to the datahub.
+// If files are given, only those are rendered. With an output path, every config file is written
+// to a mirror of the config directory instead.
+func (app *App) Render(files []string) error {
+	if app.Env.OutputPath != "" {
+		return app.renderToDirectory(files)
+	}
+
+	err := verifyEnv(app.Env.RootPath, app.Env.EnvironmentFiles)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		files, err = app.Env.GetConfigFiles()
+		if err != nil {
+			return err
+		}
+	}
+	variables, err := app.Env.GetEnvironmentVariables()
+	if err != nil {
+		return err
+	}
+
+	rendered := make(map[string]interface{})
+	for _, file := range files {
+		renderedFile, err := app.renderFile(file, variables)
+		if err != nil {
+			return fmt.Errorf("failed to render '%s': %w", file, err)
+		}
+		content := renderedFile.Content
+		relPath, err := filepath.Rel(app.Env.RootPath, file)
+		if err != nil {
+			relPath = file
+		}
+		if app.Env.EnableJsonOut {
+			var jsonContent interface{}
+			if err := json.Unmarshal(content, &jsonContent); err != nil {
+				return fmt.Errorf("rendered '%s' is not valid json: %w", file, err)
+			}
+			rendered[relPath] = jsonContent
+			continue
+		}
+		pterm.DefaultSection.Println(relPath)
+		pterm.Println(utils.Redact(string(pretty.Color(pretty.Pretty(content), nil))))
+	}
+
+	if app.Env.EnableJsonOut {
+		jsonOutput, err := json.Marshal(rendered)
+		if err != nil {
+			return err
+		}
+		fmt.Println(utils.Redact(string(jsonOutput)))
+	}
+	return nil
+}
+
+// renderToDirectory writes the templated config files and transforms to the output path,
+// keeping their path relative to the config root
+func (app *App) renderToDirectory(files []string) error {
+	err := verifyEnv(app.Env.RootPath, app.Env.EnvironmentFiles)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		files, err = app.Env.GetConfigFiles()
+		if err != nil {
+			return err
+		}
+	}
+	variables, err := app.Env.GetEnvironmentVariables()
+	if err != nil {
+		return err
+	}
+
+	written := 0
+	for _, file := range files {
+		relPath, err := filepath.Rel(app.Env.RootPath, file)
+		if err != nil {
+			return err
+		}
+		rendered, err := app.renderFile(file, variables)
+		if err != nil {
+			return fmt.Errorf("failed to render '%s': %w", file, err)
+		}
+		content := rendered.Content
+		if json.Valid(content) {
+			// sorted keys keep the rendered output stable, so outputs for different envs can be diffed
+			content = pretty.PrettyOptions(content, &pretty.Options{Width: 80, Indent: "  ", SortKeys: true})
+		} else {
+			pterm.Warning.Printf("Rendered '%s' is not valid json, writing it as is\n", relPath)
+		}
+		// yaml and jsonc configs are rendered to json
+		relPath = strings.TrimSuffix(relPath, filepath.Ext(relPath)) + ".json"
+		if err := writeRendered(filepath.Join(app.Env.OutputPath, relPath), []byte(utils.Redact(string(content)))); err != nil {
+			return err
+		}
+		written++
+	}
+
+	root := filepath.Join(app.Env.RootPath, app.Env.Project.Transforms)
+	if _, err := os.Stat(root); err == nil {
+		err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			relPath, err := filepath.Rel(app.Env.RootPath, path)
+			if err != nil {
+				return err
+			}
+			transformPath, err := filepath.Rel(root, path)
+			if err != nil {
+				return err
+			}
+			// transforms are templated with the same variables as the config files
+			content, err := app.renderTransform(transformPath, variables)
+			if err != nil {
+				return fmt.Errorf("failed to render transform '%s': %w", transformPath, err)
+			}
+			written++
+			return writeRendered(filepath.Join(app.Env.OutputPath, relPath), content)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	pterm.Success.Printf("Rendered %d files to %s\n", written, app.Env.OutputPath)
+	return nil
+}
+
+func writeRendered(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
+// renderedFile is a templated config file, with the source map back to the file it was rendered from
+type renderedFile struct {
+	Source    []byte
+	Content   []byte
+	SourceMap *templating.SourceMap
+}
+
+// position returns the line and column in the source file of an offset in the rendered content
+func (f *renderedFile) position(offset int64) (int, int) {
+	return utils.Position(f.Source, f.SourceMap.Source(offset))
+}
+
+// pointerPosition returns the line and column in the source file of the value at a json pointer
+func (f *renderedFile) pointerPosition(pointer string) (int, int) {
+	return f.position(schema.Locate(f.Content, pointer))
+}
+
+// renderFile applies includes and variables to a config file
+func (app *App) renderFile(file string, variables map[string]interface{}) (*renderedFile, error) {
+	rawJson, err := utils.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	updatedJson, logicMap, err := app.T.ReplaceVariableLogic(rawJson, file, app.Env.RootPath, app.Env.IncludeRoots())
+	if err != nil {
+		return nil, err
+	}
+	if app.Env.TemplateEngine == "go" || strings.Contains(filepath.Base(file), ".tmpl.") {
+		name, err := filepath.Rel(app.Env.RootPath, file)
+		if err != nil {
+			name = file
+		}
+		funcs := app.T.Funcs(app.Env.Name(variables), app.Secrets)
+		content, templateMap, err := app.T.ReplaceTemplateVariables(name, updatedJson, variables, funcs)
+		if err != nil {
+			return nil, err
+		}
+		sourceMap := logicMap.Then(templateMap)
+		if utils.IsYaml(file) {
+			return yamlRenderedFile(rawJson, content, sourceMap)
+		}
+		if utils.IsJsonc(file) {
+			content = utils.StripJsonComments(content)
+		}
+		return &renderedFile{Source: rawJson, Content: content, SourceMap: sourceMap}, nil
+	}
+	withVariables, variableMap, err := app.T.ReplaceVariables(updatedJson, variables)
+	if err != nil {
+		return nil, err
+	}
+	content, secretMap, err := app.T.ReplaceSecrets(withVariables, app.Secrets)
+	if err != nil {
+		return nil, err
+	}
+	sourceMap := logicMap.Then(variableMap).Then(secretMap)
+	if utils.IsYaml(file) {
+		return yamlRenderedFile(rawJson, content, sourceMap)
+	}
+	if utils.IsJsonc(file) {
+		// comments are blanked out in place, so the source map still applies
+		content = utils.StripJsonComments(content)
+	}
+	return &renderedFile{Source: rawJson, Content: content, SourceMap: sourceMap}, nil
+}
+
+// yamlRenderedFile converts a templated yaml config to json, with a source map from the json back through
+// the yaml to the config file
+func yamlRenderedFile(source []byte, content []byte, sourceMap *templating.SourceMap) (*renderedFile, error) {
+	jsonContent, err := utils.YamlToJson(content)
+	if err != nil {
+		return nil, fmt.Errorf("invalid yaml: %w", err)
+	}
+	return &renderedFile{Source: source, Content: jsonContent, SourceMap: sourceMap.Then(templating.YamlSourceMap(content, jsonContent))}, nil
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/datahub"
+	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
+	"github.com/pterm/pterm"
+	"time"
+)
+
+// RollbackTo returns the datahub to the manifest of a previous deployment, with the transforms it deployed
+func (app *App) RollbackTo(deploymentId string) error {
+	err := app.Connect()
+	if err != nil {
+		return err
+	}
+	record, err := app.getDeployment(deploymentId)
+	if err != nil {
+		return err
+	}
+	if record.Status != "succeeded" {
+		return fmt.Errorf("deployment '%s' %s, only a succeeded deployment can be rolled back to", record.Id, record.Status)
+	}
+	if record.Configs == nil {
+		return fmt.Errorf("deployment '%s' has no manifest stored in the history, it can not be rolled back to", record.Id)
+	}
+
+	lock, err := app.M.acquireLock()
+	if err != nil {
+		return err
+	}
+	app.restoring = record
+	app.transforms = make(map[string][]byte, len(record.Transforms))
+	for digest, code := range record.Transforms {
+		app.transforms[digest] = []byte(code)
+	}
+	plan, err := app.createRollbackPlan(record)
+	if err == nil {
+		pterm.Info.Printf("Rolling back to deployment '%s' of commit '%s' with %d operations\n", record.Id, record.Commit, len(plan.Manifest.Operations))
+		err = app.applyPlan(plan)
+	}
+	app.restoring = nil
+	return errors.Join(err, app.M.releaseLock(lock))
+}
+
+// createRollbackPlan diffs the manifest of a previous deployment against the manifest in the datahub
+func (app *App) createRollbackPlan(record *deploymentRecord) (*Plan, error) {
+	targetManifest := Manifest{
+		Id:       app.Env.ManifestId,
+		Manifest: record.Configs,
+	}
+	previousManifest, err := app.M.getManifestFromDatahub()
+	if datahub.IsNotFound(err) && app.Env.CreateManifestIfMissing {
+		pterm.Warning.Println("No manifest found in the datahub. Rolling back from an empty datahub.")
+		previousManifest = new(Manifest)
+	} else if err != nil {
+		return nil, err
+	}
+
+	operations, err := app.checkOwnership(diffManifest(previousManifest, targetManifest))
+	if err != nil {
+		return nil, err
+	}
+	// the manifest holds no secrets, so configs with secrets can only be restored from the config files
+	var problems []utils.ErrorDetails
+	for _, op := range operations {
+		if op.Action != "delete" && hasRedactedValues(op.Config.JsonContent) {
+			problems = append(problems, utils.ErrorDetails{
+				File:    op.Config.Path,
+				Message: fmt.Sprintf("The %s '%s' holds secrets that are not stored in the history, deploy it from the config files instead", op.Config.Type, op.Config.Id),
+			})
+		}
+	}
+	for _, problem := range problems {
+		utils.LogError(problem, app.Env.LogFormat)
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("rollback refused, %d configs can not be restored from the history", len(problems))
+	}
+
+	operations = orderOperations(operations)
+	app.addTransformDiffs(previousManifest, operations)
+	targetManifest.Operations = operations
+	targetManifest.Transforms, err = app.manifestTransforms(targetManifest.Manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Plan{
+		Version:  planVersion,
+		Created:  time.Now().UTC(),
+		Datahub:  app.Env.MimServer,
+		Manifest: targetManifest,
+	}, nil
+}
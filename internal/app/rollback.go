@@ -0,0 +1,154 @@
+package app
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/datahub"
+	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
+	"github.com/pterm/pterm"
+)
+
+// snapshot is the remote state of a config before an operation changed it
+type snapshot struct {
+	operation   operation
+	exists      bool
+	remote      []byte
+	dataset     *datahub.Dataset
+	entities    []byte
+	sinkDataset string
+}
+
+// transaction snapshots the remote configs before they are changed, so that a failed deployment
+// can be reverted to the state before it started
+type transaction struct {
+	client    datahub.Client
+	snapshots []snapshot
+}
+
+func newTransaction(client datahub.Client) *transaction {
+	return &transaction{client: client}
+}
+
+// snapshot stores the current remote version of the config the operation is about to change
+func (t *transaction) snapshot(op operation) error {
+	s := snapshot{operation: op}
+	var err error
+	switch op.Config.Type {
+	case "job":
+		s.remote, err = t.client.GetJob(op.Config.Id)
+		if op.Action != "delete" {
+			// remember sink datasets created by the deployment so they can be removed again
+			if _, ok := op.Config.JsonContent["sink"].(map[string]interface{}); ok {
+				name := determineSinkDataset(op.Config.JsonContent)
+				if _, sinkErr := t.client.GetDataset(name); name != "" && datahub.IsNotFound(sinkErr) {
+					s.sinkDataset = name
+				}
+			}
+		}
+	case "content":
+		s.remote, err = t.client.GetContent(op.Config.Id)
+	case "dataset":
+		s.dataset, err = t.client.GetDataset(op.Config.Id)
+		if err == nil {
+			var entities []datahub.Entity
+			entities, err = t.client.GetEntities(op.Config.Id)
+			if err == nil {
+				s.entities, err = json.Marshal(entities)
+			}
+		}
+	}
+
+	if datahub.IsNotFound(err) {
+		s.exists = false
+	} else if err != nil {
+		return fmt.Errorf("failed to snapshot %s '%s' before %s: %w", op.Config.Type, op.Config.Id, op.Action, err)
+	} else {
+		s.exists = true
+	}
+	t.snapshots = append(t.snapshots, s)
+	return nil
+}
+
+// rollback restores every snapshot in reverse order and returns a line for each restored or deleted config
+func (t *transaction) rollback() ([]string, error) {
+	var report []string
+	var failed int
+	for i := len(t.snapshots) - 1; i >= 0; i-- {
+		s := t.snapshots[i]
+		message, err := t.restore(s)
+		if err != nil {
+			failed++
+			report = append(report, fmt.Sprintf("FAILED to restore %s '%s': %s", s.operation.Config.Type, s.operation.Config.Id, err.Error()))
+			continue
+		}
+		report = append(report, message)
+		if s.sinkDataset != "" {
+			message, err := deleted(fmt.Sprintf("dataset '%s' created for job '%s'", s.sinkDataset, s.operation.Config.Id), t.client.DeleteDataset(s.sinkDataset))
+			if err != nil {
+				failed++
+				report = append(report, fmt.Sprintf("FAILED to delete created dataset '%s': %s", s.sinkDataset, err.Error()))
+			} else {
+				report = append(report, message)
+			}
+		}
+	}
+	if failed > 0 {
+		return report, fmt.Errorf("%d configs could not be rolled back", failed)
+	}
+	return report, nil
+}
+
+func (t *transaction) restore(s snapshot) (string, error) {
+	id := s.operation.Config.Id
+	switch s.operation.Config.Type {
+	case "job":
+		if !s.exists {
+			return deleted(fmt.Sprintf("job '%s'", id), t.client.DeleteJob(id))
+		}
+		// the remote job already contains the code of its transform
+		return fmt.Sprintf("Restored job '%s'", id), t.client.AddJob(s.remote, nil)
+	case "content":
+		if !s.exists {
+			return deleted(fmt.Sprintf("content '%s'", id), t.client.DeleteContent(id))
+		}
+		return fmt.Sprintf("Restored content '%s'", id), t.client.AddContent(s.remote)
+	case "dataset":
+		message, err := deleted(fmt.Sprintf("dataset '%s'", id), t.client.DeleteDataset(id))
+		if err != nil || !s.exists {
+			return message, err
+		}
+		if err := t.client.CreateDataset(id, s.dataset.PublicNamespaces); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("Restored dataset '%s'", id), t.client.StoreEntities(id, s.entities)
+	}
+	return "", fmt.Errorf("unknown config type '%s'", s.operation.Config.Type)
+}
+
+// deleted returns the message for a delete of the described config, which is successful as well when
+// the config was already gone
+func deleted(description string, err error) (string, error) {
+	if datahub.IsNotFound(err) {
+		return fmt.Sprintf("Nothing to delete, %s is already absent", description), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return "Deleted " + description, nil
+}
+
+// rollbackDeployment reverts the transaction and reports what was rolled back
+func (app *App) rollbackDeployment(tx *transaction) error {
+	pterm.Println()
+	utils.LogPlain("Deployment failed, rolling back the changes already written to the datahub:", app.Env.LogFormat)
+	report, err := tx.rollback()
+	for _, line := range report {
+		utils.LogPlain(" * "+line, app.Env.LogFormat)
+	}
+	if err != nil {
+		pterm.Error.Println("Rollback incomplete: ", err.Error())
+		return err
+	}
+	pterm.Warning.Printf("Rolled back %d changes\n", len(tx.snapshots))
+	return nil
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/datahub"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// deleteClient deletes the configs it holds, and answers with not found for every other config
+type deleteClient struct {
+	datahub.Client
+	existing map[string]bool
+}
+
+func (c *deleteClient) delete(id string) error {
+	if !c.existing[id] {
+		return &datahub.Error{StatusCode: http.StatusNotFound, Operation: "delete " + id}
+	}
+	delete(c.existing, id)
+	return nil
+}
+
+func (c *deleteClient) DeleteJob(id string) error     { return c.delete(id) }
+func (c *deleteClient) DeleteContent(id string) error { return c.delete(id) }
+func (c *deleteClient) DeleteDataset(id string) error { return c.delete(id) }
+
+func TestRollbackReportsEveryConfig(t *testing.T) {
+	client := &deleteClient{existing: map[string]bool{"import": true, "mapping": true}}
+	tx := newTransaction(client)
+	tx.snapshots = []snapshot{
+		{operation: configOp("add", "content", "mapping")},
+		{operation: configOp("add", "content", "removed")},
+		{operation: configOp("add", "job", "import"), sinkDataset: "people"},
+	}
+	report, err := tx.rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"Deleted job 'import'",
+		"Nothing to delete, dataset 'people' created for job 'import' is already absent",
+		"Nothing to delete, content 'removed' is already absent",
+		"Deleted content 'mapping'",
+	}
+	if !reflect.DeepEqual(report, want) {
+		t.Errorf("rollback() = %q, want %q", report, want)
+	}
+}
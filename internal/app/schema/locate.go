@@ -0,0 +1,90 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var errFound = errors.New("found")
+
+type locator struct {
+	decoder *json.Decoder
+	content []byte
+	target  string
+	offset  int64
+}
+
+// Locate returns the byte offset of the value at a json pointer. For object members the offset of
+// the key is returned. If the pointer does not exist, the offset of its closest existing parent is used.
+func Locate(content []byte, pointer string) int64 {
+	for {
+		l := &locator{decoder: json.NewDecoder(bytes.NewReader(content)), content: content, target: pointer}
+		if err := l.value(""); errors.Is(err, errFound) {
+			return l.offset
+		}
+		if pointer == "" {
+			return 0
+		}
+		pointer = pointer[:strings.LastIndex(pointer, "/")]
+	}
+}
+
+// next returns the offset of the next token, skipping the whitespace and separators the decoder has not consumed yet
+func (l *locator) next() int64 {
+	offset := l.decoder.InputOffset()
+	for offset < int64(len(l.content)) {
+		switch l.content[offset] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			offset++
+			continue
+		}
+		break
+	}
+	return offset
+}
+
+func (l *locator) value(path string) error {
+	start := l.next()
+	if path == l.target {
+		l.offset = start
+		return errFound
+	}
+	token, err := l.decoder.Token()
+	if err != nil {
+		return err
+	}
+	switch token {
+	case json.Delim('{'):
+		for l.decoder.More() {
+			keyOffset := l.next()
+			key, err := l.decoder.Token()
+			if err != nil {
+				return err
+			}
+			childPath := path + "/" + escape(key.(string))
+			if childPath == l.target {
+				l.offset = keyOffset
+				return errFound
+			}
+			if err := l.value(childPath); err != nil {
+				return err
+			}
+		}
+		_, err = l.decoder.Token()
+	case json.Delim('['):
+		for i := 0; l.decoder.More(); i++ {
+			if err := l.value(path + "/" + strconv.Itoa(i)); err != nil {
+				return err
+			}
+		}
+		_, err = l.decoder.Token()
+	}
+	return err
+}
+
+func escape(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
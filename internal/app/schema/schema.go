@@ -0,0 +1,127 @@
+package schema
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"sort"
+	"sync"
+)
+
+//go:embed schemas/*.json
+var schemaFiles embed.FS
+
+var (
+	compileOnce sync.Once
+	compiled    map[string]*jsonschema.Schema
+	compileErr  error
+)
+
+// Problem is a single schema violation. Pointer is the json pointer of the offending value,
+// and Offset its byte offset in the validated document.
+type Problem struct {
+	Pointer string
+	Offset  int64
+	Message string
+}
+
+// Types returns the config types that have a schema
+func Types() []string {
+	return []string{"content", "dataset", "job"}
+}
+
+func schemas() (map[string]*jsonschema.Schema, error) {
+	compileOnce.Do(func() {
+		compiler := jsonschema.NewCompiler()
+		compiled = make(map[string]*jsonschema.Schema)
+		for _, configType := range Types() {
+			file := "schemas/" + configType + ".json"
+			content, err := schemaFiles.ReadFile(file)
+			if err != nil {
+				compileErr = err
+				return
+			}
+			if err := compiler.AddResource(file, bytes.NewReader(content)); err != nil {
+				compileErr = err
+				return
+			}
+		}
+		for _, configType := range Types() {
+			s, err := compiler.Compile("schemas/" + configType + ".json")
+			if err != nil {
+				compileErr = fmt.Errorf("failed to compile the %s schema: %w", configType, err)
+				return
+			}
+			compiled[configType] = s
+		}
+	})
+	return compiled, compileErr
+}
+
+// Validate checks the json content of a config against the schema of its type.
+// Configs of a type without a schema are always valid.
+func Validate(configType string, content []byte) ([]Problem, error) {
+	all, err := schemas()
+	if err != nil {
+		return nil, err
+	}
+	s, ok := all[configType]
+	if !ok {
+		return nil, nil
+	}
+	var document interface{}
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&document); err != nil {
+		return nil, err
+	}
+	err = s.Validate(document)
+	if err == nil {
+		return nil, nil
+	}
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return nil, err
+	}
+
+	var problems []Problem
+	seen := make(map[string]bool)
+	for _, leaf := range leafErrors(validationErr) {
+		key := leaf.InstanceLocation + leaf.Message
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		problems = append(problems, Problem{
+			Pointer: leaf.InstanceLocation,
+			Offset:  Locate(content, leaf.InstanceLocation),
+			Message: message(leaf),
+		})
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Offset < problems[j].Offset
+	})
+	return problems, nil
+}
+
+// leafErrors returns the innermost errors, the outer ones only say that a sub schema failed
+func leafErrors(err *jsonschema.ValidationError) []*jsonschema.ValidationError {
+	if len(err.Causes) == 0 {
+		return []*jsonschema.ValidationError{err}
+	}
+	var leaves []*jsonschema.ValidationError
+	for _, cause := range err.Causes {
+		leaves = append(leaves, leafErrors(cause)...)
+	}
+	return leaves
+}
+
+func message(err *jsonschema.ValidationError) string {
+	if err.InstanceLocation == "" {
+		return err.Message
+	}
+	return fmt.Sprintf("%s: %s", err.InstanceLocation, err.Message)
+}
@@ -0,0 +1,39 @@
+package secrets
+
+import (
+	"os"
+	"strings"
+)
+
+const envPrefix = "MIM_SECRET_"
+
+// EnvProvider reads secrets from environment variables. The path 'database/password' is read from
+// MIM_SECRET_DATABASE_PASSWORD.
+type EnvProvider struct{}
+
+func NewEnvProvider() *EnvProvider {
+	return &EnvProvider{}
+}
+
+func (p *EnvProvider) Name() string {
+	return "env"
+}
+
+func (p *EnvProvider) Get(path string) (string, error) {
+	value, exists := os.LookupEnv(EnvName(path))
+	if !exists {
+		return "", ErrNotFound
+	}
+	return value, nil
+}
+
+// EnvName returns the environment variable holding the secret at path
+func EnvName(path string) string {
+	name := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, strings.Join(splitPath(path), "_"))
+	return envPrefix + strings.ToUpper(name)
+}
@@ -0,0 +1,100 @@
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	"fmt"
+	"io"
+	"os"
+)
+
+// FileProvider reads secrets from a json file encrypted with age. The path 'database/password'
+// is read from {"database": {"password": "..."}}.
+type FileProvider struct {
+	file     string
+	identity string
+	secrets  map[string]interface{}
+}
+
+func NewFileProvider(file string, identity string) *FileProvider {
+	return &FileProvider{file: file, identity: identity}
+}
+
+func (p *FileProvider) Name() string {
+	return "file"
+}
+
+func (p *FileProvider) Get(path string) (string, error) {
+	if p.secrets == nil {
+		secrets, err := p.decrypt()
+		if err != nil {
+			return "", err
+		}
+		p.secrets = secrets
+	}
+
+	var value interface{} = p.secrets
+	for _, segment := range splitPath(path) {
+		parent, ok := value.(map[string]interface{})
+		if !ok {
+			return "", ErrNotFound
+		}
+		value, ok = parent[segment]
+		if !ok {
+			return "", ErrNotFound
+		}
+	}
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64, bool:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("secret '%s' in '%s' is not a single value", path, p.file)
+	}
+}
+
+// decrypt reads the secrets file with the identities in the identity file
+func (p *FileProvider) decrypt() (map[string]interface{}, error) {
+	if p.file == "" {
+		return nil, errors.New("the file secret provider needs a secrets file, set it with --secrets-file")
+	}
+	if p.identity == "" {
+		return nil, errors.New("the file secret provider needs an age identity file, set it with --age-identity")
+	}
+	identityFile, err := os.Open(p.identity)
+	if err != nil {
+		return nil, err
+	}
+	defer identityFile.Close()
+	identities, err := age.ParseIdentities(identityFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read age identity '%s': %w", p.identity, err)
+	}
+
+	encrypted, err := os.ReadFile(p.file)
+	if err != nil {
+		return nil, err
+	}
+	var in io.Reader = bytes.NewReader(encrypted)
+	if bytes.HasPrefix(encrypted, []byte(armor.Header)) {
+		in = armor.NewReader(in)
+	}
+	decrypted, err := age.Decrypt(bufio.NewReader(in), identities...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secrets file '%s': %w", p.file, err)
+	}
+	content, err := io.ReadAll(decrypted)
+	if err != nil {
+		return nil, err
+	}
+	secrets := make(map[string]interface{})
+	if err := json.Unmarshal(content, &secrets); err != nil {
+		return nil, fmt.Errorf("secrets file '%s' does not contain a json object: %w", p.file, err)
+	}
+	return secrets, nil
+}
@@ -0,0 +1,70 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
+	"strings"
+)
+
+// ErrNotFound is returned by a provider when it has no secret for the path
+var ErrNotFound = errors.New("secret not found")
+
+// Provider resolves secret references like 'database/password' to their value
+type Provider interface {
+	// Name is used in messages about the provider
+	Name() string
+	Get(path string) (string, error)
+}
+
+type Options struct {
+	File       string
+	Identity   string
+	VaultAddr  string
+	VaultToken string
+	VaultMount string
+}
+
+// NewProvider creates the secret provider for the given backend
+func NewProvider(backend string, opts Options) (Provider, error) {
+	switch backend {
+	case "", "env":
+		return NewEnvProvider(), nil
+	case "file":
+		return NewFileProvider(opts.File, opts.Identity), nil
+	case "vault":
+		return NewVaultProvider(opts.VaultAddr, opts.VaultToken, opts.VaultMount), nil
+	default:
+		return nil, fmt.Errorf("unknown secret provider '%s', expected 'env', 'file' or 'vault'", backend)
+	}
+}
+
+// splitPath splits a secret path in its non-empty segments
+func splitPath(path string) []string {
+	var segments []string
+	for _, segment := range strings.Split(path, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	return segments
+}
+
+// masked registers every secret it resolves, so it is masked in the log output
+type masked struct {
+	Provider
+	logFormat string
+}
+
+// WithMasking wraps a provider so that the secrets it resolves are never logged
+func WithMasking(provider Provider, logFormat string) Provider {
+	return &masked{Provider: provider, logFormat: logFormat}
+}
+
+func (p *masked) Get(path string) (string, error) {
+	value, err := p.Provider.Get(path)
+	if err == nil {
+		utils.RegisterSecret(value, p.logFormat)
+	}
+	return value, err
+}
@@ -0,0 +1,105 @@
+package secrets
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VaultProvider reads secrets from a key/value version 2 engine of a HashiCorp Vault compatible API.
+// The last segment of the path is the key, so 'database/password' is the key 'password' of the secret 'database'.
+type VaultProvider struct {
+	addr    string
+	token   string
+	mount   string
+	client  *http.Client
+	secrets map[string]map[string]interface{}
+}
+
+func NewVaultProvider(addr string, token string, mount string) *VaultProvider {
+	if mount == "" {
+		mount = "secret"
+	}
+	return &VaultProvider{
+		addr:    strings.TrimSuffix(addr, "/"),
+		token:   strings.TrimSpace(token),
+		mount:   strings.Trim(mount, "/"),
+		client:  &http.Client{Timeout: 30 * time.Second},
+		secrets: make(map[string]map[string]interface{}),
+	}
+}
+
+func (p *VaultProvider) Name() string {
+	return "vault"
+}
+
+func (p *VaultProvider) Get(path string) (string, error) {
+	segments := splitPath(path)
+	if len(segments) < 2 {
+		return "", fmt.Errorf("vault secret '%s' must be written as 'path/key'", path)
+	}
+	secretPath := strings.Join(segments[:len(segments)-1], "/")
+	key := segments[len(segments)-1]
+
+	secret, exists := p.secrets[secretPath]
+	if !exists {
+		var err error
+		secret, err = p.read(secretPath)
+		if err != nil {
+			return "", err
+		}
+		p.secrets[secretPath] = secret
+	}
+	value, exists := secret[key]
+	if !exists || value == nil {
+		return "", ErrNotFound
+	}
+	if stringValue, ok := value.(string); ok {
+		return stringValue, nil
+	}
+	return fmt.Sprint(value), nil
+}
+
+// read returns the data of the latest version of a secret, a missing secret has no data
+func (p *VaultProvider) read(secretPath string) (map[string]interface{}, error) {
+	if p.addr == "" {
+		return nil, errors.New("the vault secret provider needs an address, set it with --vault-addr or VAULT_ADDR")
+	}
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/v1/%s/data/%s", p.addr, p.mount, secretPath), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", p.token)
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret '%s' from vault: %w", secretPath, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return map[string]interface{}{}, nil
+	}
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("failed to read secret '%s' from vault: %s %s", secretPath, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	response := struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse secret '%s' from vault: %w", secretPath, err)
+	}
+	if response.Data.Data == nil {
+		return map[string]interface{}{}, nil
+	}
+	return response.Data.Data, nil
+}
@@ -0,0 +1,106 @@
+package templating
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/secrets"
+	"os"
+	"reflect"
+	"strings"
+	"text/template"
+)
+
+// Funcs returns the functions available in go templates. envName is the name of the environment
+// being deployed, and secrets are resolved with the provider.
+func (t *Templating) Funcs(envName string, provider secrets.Provider) template.FuncMap {
+	return template.FuncMap{
+		"default":    defaultValue,
+		"empty":      empty,
+		"lower":      strings.ToLower,
+		"upper":      strings.ToUpper,
+		"trim":       strings.TrimSpace,
+		"trimPrefix": func(prefix string, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trimSuffix": func(suffix string, s string) string { return strings.TrimSuffix(s, suffix) },
+		"replace":    func(old string, new string, s string) string { return strings.ReplaceAll(s, old, new) },
+		"contains":   func(substr string, s string) bool { return strings.Contains(s, substr) },
+		"hasPrefix":  func(prefix string, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix string, s string) bool { return strings.HasSuffix(s, suffix) },
+		"split":      func(sep string, s string) []string { return strings.Split(s, sep) },
+		"join":       join,
+		"quote":      func(value interface{}) string { return fmt.Sprintf("%q", fmt.Sprint(value)) },
+		"toJson":     toJson,
+		"env":        os.Getenv,
+		"envName":    func() string { return envName },
+		"isEnv": func(names ...string) bool {
+			for _, name := range names {
+				if name == envName {
+					return true
+				}
+			}
+			return false
+		},
+		"secret": func(path string) (string, error) {
+			value, err := provider.Get(path)
+			if errors.Is(err, secrets.ErrNotFound) {
+				// left as a secret reference, so it is reported with the other unresolved expressions
+				return fmt.Sprintf("{{ secret '%s' }}", path), nil
+			}
+			if err != nil {
+				return "", err
+			}
+			escaped, err := json.Marshal(value)
+			if err != nil {
+				return "", err
+			}
+			return string(escaped[1 : len(escaped)-1]), nil
+		},
+	}
+}
+
+// defaultValue returns the value, or the default if the value is missing or empty.
+// Used as {{ .batchSize | default 1000 }}
+func defaultValue(def interface{}, value ...interface{}) interface{} {
+	if len(value) == 0 || empty(value[0]) {
+		return def
+	}
+	return value[0]
+}
+
+func empty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	case reflect.Bool:
+		return !v.Bool()
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		return v.Int() == 0
+	case reflect.Float64, reflect.Float32:
+		return v.Float() == 0
+	}
+	return false
+}
+
+func join(sep string, values interface{}) string {
+	v := reflect.ValueOf(values)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Sprint(values)
+	}
+	parts := make([]string, v.Len())
+	for i := range parts {
+		parts[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(parts, sep)
+}
+
+func toJson(value interface{}) (string, error) {
+	jsonValue, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(jsonValue), nil
+}
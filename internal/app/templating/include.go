@@ -0,0 +1,210 @@
+package templating
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
+	"gopkg.in/yaml.v3"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var logicPattern = regexp.MustCompile(`"\{%\s*(.+?)\s*%\}"`)
+
+// includePattern matches the arguments of an include expression. Paths are quoted with single quotes,
+// or with escaped double quotes when they contain a single quote.
+var includePattern = regexp.MustCompile(`^include\s+(?:(\w+)\()?(?:'([^']*)'|\\"([^"\\]*)\\")(\))?(\s+select\s+(?:'([^']*)'|\\"([^"\\]*)\\"))?$`)
+
+// include is a parsed include expression
+type include struct {
+	// kind is empty for a single document, or list, text or base64
+	kind        string
+	path        string
+	selector    string
+	hasSelector bool
+}
+
+func parseInclude(expression string) (*include, error) {
+	match := includePattern.FindStringSubmatch(expression)
+	if match == nil {
+		return nil, fmt.Errorf("unable to parse include expression '%s'", expression)
+	}
+	inc := &include{kind: match[1], path: match[2] + match[3]}
+	if (inc.kind == "") != (match[4] == "") {
+		return nil, fmt.Errorf("unable to parse include expression '%s'", expression)
+	}
+	switch inc.kind {
+	case "", "list", "text", "base64":
+	default:
+		return nil, fmt.Errorf("unknown include function '%s' in '%s'", inc.kind, expression)
+	}
+	if match[5] != "" {
+		inc.hasSelector = true
+		inc.selector = match[6] + match[7]
+		if inc.kind == "text" || inc.kind == "base64" {
+			return nil, fmt.Errorf("select can not be used with %s includes in '%s'", inc.kind, expression)
+		}
+	}
+	return inc, nil
+}
+
+// includeContext is where include paths are looked up, and how included files are named in errors
+type includeContext struct {
+	rootPath string
+	roots    []string
+}
+
+// ReplaceVariableLogic executes the include expressions in the json of a config file. Include paths are
+// looked up in the include roots in order, and the first root with a matching file is used. Included json
+// and yaml files can include other files themselves, text and base64 includes insert the file as a string.
+func (t *Templating) ReplaceVariableLogic(jsonBytes []byte, file string, rootPath string, includeRoots []string) ([]byte, *SourceMap, error) {
+	ctx := &includeContext{rootPath: rootPath, roots: includeRoots}
+	return t.replaceIncludes(jsonBytes, ctx, []string{absPath(file)})
+}
+
+// replaceIncludes executes the include expressions in content, stack holds the files currently being included
+func (t *Templating) replaceIncludes(content []byte, ctx *includeContext, stack []string) ([]byte, *SourceMap, error) {
+	stringifiedJson := string(content)
+
+	results := logicPattern.FindAllStringSubmatchIndex(stringifiedJson, -1)
+	output, sourceMap, err := replaceMatches(stringifiedJson, results, func(result []int) (string, error) {
+		expression := stringifiedJson[result[2]:result[3]]
+
+		// Possibly add other logic operators in the future
+		if strings.Fields(expression)[0] != "include" {
+			return stringifiedJson[result[0]:result[1]], nil
+		}
+		inc, err := parseInclude(expression)
+		if err != nil {
+			return "", err
+		}
+		files, err := ctx.glob(inc.path)
+		if err != nil {
+			return "", err
+		}
+		if len(files) == 0 {
+			return "null", nil
+		}
+		var parts []string
+		for _, file := range files {
+			part, err := t.includeFile(file, inc, ctx, stack)
+			if err != nil {
+				return "", err
+			}
+			parts = append(parts, part)
+		}
+		if inc.kind != "list" && len(parts) == 1 {
+			return parts[0], nil
+		}
+		return "[" + strings.Join(parts, ",") + "]", nil
+	})
+	if err != nil {
+		return content, nil, err
+	}
+	return []byte(output), sourceMap, nil
+}
+
+// includeFile returns the json to insert for a single included file
+func (t *Templating) includeFile(file string, inc *include, ctx *includeContext, stack []string) (string, error) {
+	content, err := utils.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	switch inc.kind {
+	case "text":
+		return marshal(string(content))
+	case "base64":
+		return marshal(base64.StdEncoding.EncodeToString(content))
+	}
+
+	path := absPath(file)
+	for i, included := range stack {
+		if included == path {
+			chain := make([]string, 0, len(stack)-i+1)
+			for _, p := range append(stack[i:len(stack):len(stack)], path) {
+				chain = append(chain, relPath(ctx.rootPath, p))
+			}
+			return "", fmt.Errorf("include cycle %s", strings.Join(chain, " -> "))
+		}
+	}
+	content, _, err = t.replaceIncludes(content, ctx, append(stack[:len(stack):len(stack)], path))
+	if err != nil {
+		return "", fmt.Errorf("failed to include '%s': %w", relPath(ctx.rootPath, file), err)
+	}
+
+	if utils.IsJsonc(file) {
+		content = utils.StripJsonComments(content)
+	}
+
+	var value interface{}
+	if utils.IsYaml(file) {
+		if err := yaml.Unmarshal(content, &value); err != nil {
+			return "", fmt.Errorf("failed to read yaml from '%s': %w", file, err)
+		}
+	} else {
+		if !inc.hasSelector {
+			// inserted as written, so included files can use the go template as well
+			return strings.TrimSpace(string(content)), nil
+		}
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.UseNumber()
+		if err := decoder.Decode(&value); err != nil {
+			return "", fmt.Errorf("failed to read json from '%s'", file)
+		}
+	}
+
+	if inc.hasSelector {
+		selected, exists := lookupPath(value, strings.TrimPrefix(strings.TrimPrefix(inc.selector, "$"), "."))
+		if !exists {
+			return "", fmt.Errorf("path '%s' not found in '%s'", inc.selector, relPath(ctx.rootPath, file))
+		}
+		value = selected
+	}
+	jsonOutput, err := marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to convert '%s' to json: %w", relPath(ctx.rootPath, file), err)
+	}
+	return jsonOutput, nil
+}
+
+// glob returns the files matching an include path in the first include root that has any
+func (ctx *includeContext) glob(includePath string) ([]string, error) {
+	for _, root := range ctx.roots {
+		files, err := filepath.Glob(filepath.Join(root, includePath))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get files from path '%s'", includePath)
+		}
+		if len(files) > 0 {
+			return files, nil
+		}
+	}
+	return nil, nil
+}
+
+// marshal encodes value as json, without escaping html characters that are common in queries and scripts
+func marshal(value interface{}) (string, error) {
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(out.String(), "\n"), nil
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+func relPath(rootPath string, path string) string {
+	if rel, err := filepath.Rel(absPath(rootPath), absPath(path)); err == nil {
+		return rel
+	}
+	return path
+}
@@ -0,0 +1,147 @@
+package templating
+
+import (
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// SourceMap maps offsets in templated output back to offsets in the template it was rendered from.
+// Every templating step adds a stage, and offsets are mapped back through the stages in reverse order.
+type SourceMap struct {
+	stages [][]edit
+}
+
+// edit is a replaced part of the input, [srcStart, srcEnd) in the input became [outStart, outEnd) in the output
+type edit struct {
+	outStart int64
+	outEnd   int64
+	srcStart int64
+	srcEnd   int64
+}
+
+// Then returns a source map that first maps back through next, and then through m
+func (m *SourceMap) Then(next *SourceMap) *SourceMap {
+	combined := &SourceMap{}
+	if m != nil {
+		combined.stages = append(combined.stages, m.stages...)
+	}
+	if next != nil {
+		combined.stages = append(combined.stages, next.stages...)
+	}
+	return combined
+}
+
+// Source returns the offset in the template of an offset in the output. Offsets inside replaced
+// text map to the start of the expression that produced it.
+func (m *SourceMap) Source(offset int64) int64 {
+	if m == nil {
+		return offset
+	}
+	for i := len(m.stages) - 1; i >= 0; i-- {
+		edits := m.stages[i]
+		for j := len(edits) - 1; j >= 0; j-- {
+			e := edits[j]
+			if e.outStart > offset {
+				continue
+			}
+			if offset < e.outEnd {
+				offset = e.srcStart
+			} else {
+				offset = offset - e.outEnd + e.srcEnd
+			}
+			break
+		}
+	}
+	return offset
+}
+
+// replaceMatches replaces the regexp matches in input with the result of replacement, in a single pass,
+// and returns a source map of the replacements
+func replaceMatches(input string, matches [][]int, replacement func(match []int) (string, error)) (string, *SourceMap, error) {
+	var out strings.Builder
+	var edits []edit
+	last := 0
+	for _, match := range matches {
+		out.WriteString(input[last:match[0]])
+		value, err := replacement(match)
+		if err != nil {
+			return input, nil, err
+		}
+		start := out.Len()
+		out.WriteString(value)
+		last = match[1]
+		if value == input[match[0]:match[1]] {
+			// unchanged matches, like unknown variables, keep the positions inside them
+			continue
+		}
+		edits = append(edits, edit{
+			outStart: int64(start),
+			outEnd:   int64(out.Len()),
+			srcStart: int64(match[0]),
+			srcEnd:   int64(match[1]),
+		})
+	}
+	out.WriteString(input[last:])
+	return out.String(), &SourceMap{stages: [][]edit{edits}}, nil
+}
+
+// templateMarker is written before every top level node of a go template, so the output of each node
+// can be found. Top level nodes are executed exactly once and in order.
+const templateMarker = "\x00node\x00"
+
+// templateNode is the offset of a top level node of a go template, text is copied to the output as is
+type templateNode struct {
+	offset int64
+	text   bool
+}
+
+// markTemplate inserts a marker before every top level node of a parsed template, and returns the
+// offsets of the nodes in the template. Actions start at their {{, as the node starts after it.
+func markTemplate(tmpl *template.Template, source string) []templateNode {
+	if tmpl.Tree == nil || tmpl.Tree.Root == nil {
+		return nil
+	}
+	var nodes []templateNode
+	var marked []parse.Node
+	for _, node := range tmpl.Tree.Root.Nodes {
+		offset := int64(node.Position())
+		_, text := node.(*parse.TextNode)
+		if !text {
+			if start := strings.LastIndex(source[:offset], "{{"); start >= 0 {
+				offset = int64(start)
+			}
+		}
+		nodes = append(nodes, templateNode{offset: offset, text: text})
+		marked = append(marked, &parse.TextNode{NodeType: parse.NodeText, Pos: node.Position(), Text: []byte(templateMarker)}, node)
+	}
+	tmpl.Tree.Root.Nodes = marked
+	return nodes
+}
+
+// unmarkOutput removes the markers from the output of a marked template, and returns a source map of
+// the output of the nodes. Without the expected markers the output is returned without a source map.
+func unmarkOutput(output string, nodes []templateNode) (string, *SourceMap) {
+	parts := strings.Split(output, templateMarker)
+	if len(parts) != len(nodes)+1 {
+		return strings.ReplaceAll(output, templateMarker, ""), nil
+	}
+	var out strings.Builder
+	var edits []edit
+	out.WriteString(parts[0])
+	for i, node := range nodes {
+		start := int64(out.Len())
+		out.WriteString(parts[i+1])
+		if node.text {
+			// text is mapped character by character from the start of the text
+			edits = append(edits, edit{outStart: start, outEnd: start, srcStart: node.offset, srcEnd: node.offset})
+			continue
+		}
+		srcEnd := node.offset
+		if i+1 < len(nodes) {
+			srcEnd = nodes[i+1].offset
+		}
+		edits = append(edits, edit{outStart: start, outEnd: int64(out.Len()), srcStart: node.offset, srcEnd: srcEnd})
+	}
+	return out.String(), &SourceMap{stages: [][]edit{edits}}
+}
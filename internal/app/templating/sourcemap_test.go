@@ -0,0 +1,163 @@
+package templating
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+)
+
+// offsetOf returns the offset of the first occurrence of text, failing the test if it is missing
+func offsetOf(t *testing.T, content string, text string) int64 {
+	t.Helper()
+	offset := strings.Index(content, text)
+	if offset < 0 {
+		t.Fatalf("%q not found in %q", text, content)
+	}
+	return int64(offset)
+}
+
+func TestSourceMapSource(t *testing.T) {
+	sourceMap := &SourceMap{stages: [][]edit{{
+		{outStart: 2, outEnd: 7, srcStart: 2, srcEnd: 4},
+		{outStart: 10, outEnd: 10, srcStart: 12, srcEnd: 12},
+	}}}
+	tests := []struct {
+		name   string
+		offset int64
+		want   int64
+	}{
+		{name: "before the first edit", offset: 1, want: 1},
+		{name: "start of a replacement", offset: 2, want: 2},
+		{name: "inside a replacement", offset: 6, want: 2},
+		{name: "after a replacement", offset: 8, want: 5},
+		{name: "at a point edit", offset: 10, want: 12},
+		{name: "after a point edit", offset: 13, want: 15},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sourceMap.Source(tt.offset); got != tt.want {
+				t.Errorf("Source(%d) = %d, want %d", tt.offset, got, tt.want)
+			}
+		})
+	}
+
+	var empty *SourceMap
+	if got := empty.Source(5); got != 5 {
+		t.Errorf("a nil source map should not move offsets, got %d", got)
+	}
+}
+
+func TestReplaceVariablesSourceMap(t *testing.T) {
+	variables := map[string]interface{}{"name": "a much longer value", "n": 1}
+	source := `{"id": "{{ name }}", "size": "{{ n }}", "unknown": "x-{{ missing }}", "end": "here"}`
+	output, sourceMap, err := NewTemplating().ReplaceVariables([]byte(source), variables)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		output string
+		source string
+	}{
+		{name: "text before the variables", output: `"id"`, source: `"id"`},
+		{name: "replaced value", output: `"a much`, source: `"{{ name }}"`},
+		{name: "inside a replaced value", output: `longer value`, source: `"{{ name }}"`},
+		{name: "text after a replaced value", output: `"size"`, source: `"size"`},
+		{name: "unresolved variable keeps its position", output: `{{ missing }}`, source: `{{ missing }}`},
+		{name: "text after everything", output: `"here"`, source: `"here"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sourceMap.Source(offsetOf(t, string(output), tt.output))
+			if want := offsetOf(t, source, tt.source); got != want {
+				t.Errorf("%q maps to %d, want %d", tt.output, got, want)
+			}
+		})
+	}
+}
+
+func TestSourceMapThen(t *testing.T) {
+	templating := NewTemplating()
+	source := `{"a": "{{ first }}", "b": "{{ second }}", "c": 1}`
+	first, firstMap, err := templating.ReplaceVariables([]byte(source), map[string]interface{}{"first": "{{ second }}-and-more"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, secondMap, err := templating.ReplaceVariables(first, map[string]interface{}{"second": "value"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sourceMap := firstMap.Then(secondMap)
+	tests := []struct {
+		output string
+		source string
+	}{
+		{output: `value-and-more`, source: `"{{ first }}"`},
+		{output: `"b"`, source: `"b"`},
+		{output: `"c"`, source: `"c"`},
+	}
+	for _, tt := range tests {
+		got := sourceMap.Source(offsetOf(t, string(second), tt.output))
+		if want := offsetOf(t, source, tt.source); got != want {
+			t.Errorf("%q maps to %d, want %d", tt.output, got, want)
+		}
+	}
+}
+
+func TestReplaceTemplateVariablesSourceMap(t *testing.T) {
+	source := "{\n  {{- if .on }}\n  \"id\": \"{{ .id }}\",\n  {{- end }}\n  \"title\": \"{{ .missing }}\",\n  \"end\": 1\n}"
+	variables := map[string]interface{}{"on": true, "id": "a-long-id"}
+	output, sourceMap, err := NewTemplating().ReplaceTemplateVariables("test", []byte(source), variables, template.FuncMap{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(output), templateMarker) {
+		t.Fatalf("the output holds markers: %q", output)
+	}
+	tests := []struct {
+		name   string
+		output string
+		source string
+	}{
+		{name: "text before the actions", output: `{`, source: `{`},
+		{name: "output of an if", output: `"id"`, source: `{{- if .on }}`},
+		{name: "text after the if", output: `"title"`, source: `"title"`},
+		{name: "missing value", output: `<no value>`, source: `{{ .missing }}`},
+		{name: "text after everything", output: `"end"`, source: `"end"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sourceMap.Source(offsetOf(t, string(output), tt.output))
+			if want := offsetOf(t, source, tt.source); got != want {
+				t.Errorf("%q maps to %d, want %d", tt.output, got, want)
+			}
+		})
+	}
+}
+
+func TestYamlSourceMap(t *testing.T) {
+	source := "id: job1\ntype: job\ntitle: \"quoted {{ x }}\"\nsink:\n  Type: plain {{ y }}\nlist:\n  - one\n  - 2\n"
+	converted := []byte("{\n  \"id\": \"job1\",\n  \"list\": [\"one\", 2],\n  \"sink\": {\"Type\": \"plain {{ y }}\"},\n  \"title\": \"quoted {{ x }}\",\n  \"type\": \"job\"\n}")
+	sourceMap := YamlSourceMap([]byte(source), converted)
+	tests := []struct {
+		name   string
+		output string
+		source string
+	}{
+		{name: "key", output: `"sink"`, source: `sink:`},
+		{name: "nested key", output: `"Type"`, source: `Type:`},
+		{name: "plain string value", output: `plain {{`, source: `plain {{`},
+		{name: "inside a plain string", output: `{{ y }}`, source: `{{ y }}`},
+		{name: "quoted string value", output: `"quoted`, source: `"quoted`},
+		{name: "inside a quoted string", output: `{{ x }}`, source: `{{ x }}`},
+		{name: "list item", output: `2]`, source: `2`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := sourceMap.Source(offsetOf(t, string(converted), tt.output))
+			if want := offsetOf(t, source, tt.source); got != want {
+				t.Errorf("%q maps to %d, want %d", tt.output, got, want)
+			}
+		})
+	}
+}
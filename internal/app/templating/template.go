@@ -3,12 +3,13 @@ package templating
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
-	"html/template"
-	"path/filepath"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/secrets"
 	"regexp"
+	"strconv"
 	"strings"
+	"text/template"
 )
 
 type Templating struct {
@@ -18,38 +19,177 @@ func NewTemplating() *Templating {
 	return &Templating{}
 }
 
-func (t *Templating) ReplaceTemplateVariables(name string, jsonBytes []byte, variables map[string]interface{}) ([]byte, error) {
-	tmpl, err := template.New(name).Parse(string(jsonBytes))
+// ReplaceTemplateVariables executes the json as a go text/template, with the variables as data.
+// Missing variables are rendered as <no value>, and reported as unresolved after templating.
+// The source map maps the output of every top level action back to its {{ in the template.
+func (t *Templating) ReplaceTemplateVariables(name string, jsonBytes []byte, variables map[string]interface{}, funcs template.FuncMap) ([]byte, *SourceMap, error) {
+	tmpl, err := template.New(name).Funcs(funcs).Parse(string(jsonBytes))
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	nodes := markTemplate(tmpl, string(jsonBytes))
 
 	var out bytes.Buffer
 	err = tmpl.Execute(&out, variables)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	return out.Bytes(), nil
+	output, sourceMap := unmarkOutput(out.String(), nodes)
+	return []byte(output), sourceMap, nil
 }
 
-func (t *Templating) ReplaceVariables(jsonBytes []byte, variables map[string]interface{}) ([]byte, error) {
+// placeholderPattern matches any variable or logic expression
+var placeholderPattern = regexp.MustCompile(`\{\{.*?\}\}|\{%.*?%\}|<no value>`)
+
+// Placeholder is a template expression that is still present after templating
+type Placeholder struct {
+	Offset int64
+	Text   string
+}
+
+// FindPlaceholders returns the template expressions left in templated json
+func FindPlaceholders(jsonBytes []byte) []Placeholder {
+	var placeholders []Placeholder
+	for _, match := range placeholderPattern.FindAllIndex(jsonBytes, -1) {
+		placeholders = append(placeholders, Placeholder{Offset: int64(match[0]), Text: string(jsonBytes[match[0]:match[1]])})
+	}
+	return placeholders
+}
+
+// variablePattern matches a variable used as a complete json string value, or inside a string
+var variablePattern = regexp.MustCompile(`"\{\{ ([^\s{}"]+) \}\}"|\{\{ ([^\s{}"]+) \}\}`)
+
+// ReplaceVariables inserts the variables into the json. A variable that is the complete string value
+// keeps the type of the variable, inside a string the variable is inserted as text.
+// Unknown variables are left in place.
+func (t *Templating) ReplaceVariables(jsonBytes []byte, variables map[string]interface{}) ([]byte, *SourceMap, error) {
 	rawJson := string(jsonBytes)
-	for key, value := range variables {
-		inLinePattern := "[^\"]{{ " + key + " }}|{{ " + key + " }}[^\"]"
-		r, _ := regexp.Compile(inLinePattern)
-		matches := r.FindAllString(rawJson, -1)
-		for _, match := range matches {
-			replacedMatch := strings.Replace(match, "{{ "+key+" }}", value.(string), -1)
-			rawJson = strings.Replace(rawJson, match, replacedMatch, -1)
+	matches := variablePattern.FindAllStringSubmatchIndex(rawJson, -1)
+	output, sourceMap, err := replaceMatches(rawJson, matches, func(match []int) (string, error) {
+		if match[2] >= 0 {
+			value, exists := lookupVariable(variables, rawJson[match[2]:match[3]])
+			if !exists {
+				return rawJson[match[0]:match[1]], nil
+			}
+			return t.wrapWithType(value)
+		}
+		value, exists := lookupVariable(variables, rawJson[match[4]:match[5]])
+		if !exists {
+			return rawJson[match[0]:match[1]], nil
+		}
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case map[string]interface{}, []interface{}:
+			// objects and lists are inserted as escaped json, as they are inside a string
+			jsonValue, err := json.Marshal(v)
+			if err != nil {
+				return "", err
+			}
+			escaped, err := json.Marshal(string(jsonValue))
+			if err != nil {
+				return "", err
+			}
+			return string(escaped[1 : len(escaped)-1]), nil
 		}
-		wrappedValue, err := t.wrapWithType(value)
+		return fmt.Sprint(value), nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return []byte(output), sourceMap, nil
+}
+
+// secretPattern matches a secret reference, the path is quoted with single quotes or escaped double quotes
+var secretPattern = regexp.MustCompile(`\{\{ secret (?:\\"([^"\\]+)\\"|'([^']+)') \}\}`)
+
+// ReplaceSecrets inserts the secrets referenced with {{ secret 'path/key' }} into the json strings.
+// Secrets unknown to the provider are left in place.
+func (t *Templating) ReplaceSecrets(jsonBytes []byte, provider secrets.Provider) ([]byte, *SourceMap, error) {
+	rawJson := string(jsonBytes)
+	matches := secretPattern.FindAllStringSubmatchIndex(rawJson, -1)
+	output, sourceMap, err := replaceMatches(rawJson, matches, func(match []int) (string, error) {
+		var path string
+		if match[2] >= 0 {
+			path = rawJson[match[2]:match[3]]
+		} else {
+			path = rawJson[match[4]:match[5]]
+		}
+		value, err := provider.Get(path)
+		if errors.Is(err, secrets.ErrNotFound) {
+			return rawJson[match[0]:match[1]], nil
+		}
+		if err != nil {
+			return "", err
+		}
+		// secrets are always inside a json string, so they are escaped without the surrounding quotes
+		escaped, err := json.Marshal(value)
 		if err != nil {
-			return nil, err
+			return "", err
+		}
+		return string(escaped[1 : len(escaped)-1]), nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return []byte(output), sourceMap, nil
+}
+
+// lookupVariable finds a variable by name, or by a path into nested objects and lists like
+// mysql.host, servers[0].host or servers.0.host. A name containing dots is matched as is first.
+func lookupVariable(variables map[string]interface{}, path string) (interface{}, bool) {
+	if value, exists := variables[path]; exists {
+		return value, true
+	}
+	return lookupPath(variables, path)
+}
+
+// lookupPath follows a path like mysql.host, servers[0].host or servers.0.host into a value
+func lookupPath(value interface{}, path string) (interface{}, bool) {
+	var segments []string
+	for _, part := range strings.Split(path, ".") {
+		// servers[0][1] becomes the segments servers, 0 and 1
+		for {
+			open := strings.Index(part, "[")
+			if open < 0 {
+				break
+			}
+			end := strings.Index(part[open:], "]")
+			if end < 0 {
+				return nil, false
+			}
+			if open > 0 {
+				segments = append(segments, part[:open])
+			}
+			segments = append(segments, part[open+1:open+end])
+			part = part[open+end+1:]
+		}
+		if part != "" {
+			segments = append(segments, part)
 		}
-		rawJson = strings.Replace(rawJson, "\"{{ "+key+" }}\"", wrappedValue, -1)
 	}
-	return []byte(rawJson), nil
+
+	for _, segment := range segments {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			child, exists := v[segment]
+			if !exists {
+				return nil, false
+			}
+			value = child
+		case []interface{}:
+			index, err := strconv.Atoi(segment)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, false
+			}
+			value = v[index]
+		default:
+			return nil, false
+		}
+	}
+	return value, true
 }
+
 func (t *Templating) wrapWithType(inputValue interface{}) (string, error) {
 	// Used to determine type of interface data and
 	// to wrap the value to be inserted into a raw json string
@@ -68,54 +208,3 @@ func (t *Templating) wrapWithType(inputValue interface{}) (string, error) {
 		return string(jsonValue), nil
 	}
 }
-
-func (t *Templating) ReplaceVariableLogic(jsonBytes []byte, rootPath string) ([]byte, error) {
-	stringifiedJson := string(jsonBytes)
-
-	r := regexp.MustCompile(`"{%\s(.+)\s%}"`)
-	results := r.FindAllStringSubmatch(stringifiedJson, -1)
-
-	for _, result := range results {
-		logicParts := strings.Split(result[1], " ")
-		partLength := len([]rune(logicParts[1]))
-
-		// Possibly add other logic operators in the future
-		if logicParts[0] == "include" {
-			includePath := ""
-			forceList := false
-			if strings.HasPrefix(logicParts[1], "list('") {
-				forceList = true
-				// strip 'list(' and closing ')'
-				includePath = logicParts[1][6 : partLength-2]
-
-			} else if strings.HasPrefix(logicParts[1], "'") {
-				// strip ' on both sides
-				includePath = logicParts[1][1 : partLength-1]
-			} else {
-				return jsonBytes, fmt.Errorf("unable to parse include expression")
-			}
-			// Get files
-			files, err := filepath.Glob(filepath.Join(rootPath, includePath))
-			if err != nil {
-				return jsonBytes, fmt.Errorf("failed to get files from path")
-			}
-			var output []map[string]interface{}
-			for _, jsonFile := range files {
-				jsonContent, err := utils.ReadJsonFile(jsonFile)
-				if err != nil {
-					return jsonBytes, fmt.Errorf("failed to read json from '%s'", jsonFile)
-				}
-				output = append(output, jsonContent)
-			}
-			var jsonOutput []byte
-			if !forceList && len(output) == 1 {
-				jsonOutput, err = json.Marshal(output[0])
-			} else {
-				jsonOutput, err = json.Marshal(output)
-			}
-			stringifiedJson = strings.Replace(stringifiedJson, result[0], string(jsonOutput), -1)
-		}
-	}
-	return []byte(stringifiedJson), nil
-
-}
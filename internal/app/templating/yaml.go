@@ -0,0 +1,104 @@
+package templating
+
+import (
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/schema"
+	"gopkg.in/yaml.v3"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// YamlSourceMap maps offsets in the json converted from a yaml document back to the yaml document.
+// Every key and value in the json is mapped to the key or value it came from, offsets inside them
+// are mapped relative to their start.
+func YamlSourceMap(source []byte, converted []byte) *SourceMap {
+	var root yaml.Node
+	if err := yaml.Unmarshal(source, &root); err != nil || len(root.Content) == 0 {
+		return nil
+	}
+	lineStarts := []int{0}
+	for i, b := range source {
+		if b == '\n' {
+			lineStarts = append(lineStarts, i+1)
+		}
+	}
+	// offset returns the byte offset of a node, yaml counts columns in characters
+	offset := func(node *yaml.Node) int64 {
+		if node.Line < 1 || node.Line > len(lineStarts) {
+			return 0
+		}
+		i := lineStarts[node.Line-1]
+		for col := 1; col < node.Column && i < len(source); col++ {
+			_, size := utf8.DecodeRune(source[i:])
+			i += size
+		}
+		return int64(i)
+	}
+
+	var edits []edit
+	mark := func(jsonOffset int64, node *yaml.Node) {
+		src := offset(node)
+		if node.Kind == yaml.ScalarNode && node.ShortTag() == "!!str" &&
+			node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+			// plain strings are quoted in json, the text is mapped from after the quote
+			jsonOffset++
+		}
+		edits = append(edits, edit{outStart: jsonOffset, outEnd: jsonOffset, srcStart: src, srcEnd: src})
+	}
+	var walk func(node *yaml.Node, pointer string)
+	walk = func(node *yaml.Node, pointer string) {
+		for node.Kind == yaml.AliasNode && node.Alias != nil {
+			node = node.Alias
+		}
+		switch node.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(node.Content); i += 2 {
+				key, value := node.Content[i], node.Content[i+1]
+				if key.ShortTag() == "!!merge" {
+					continue
+				}
+				memberPointer := pointer + "/" + escapePointer(key.Value)
+				keyOffset := schema.Locate(converted, memberPointer)
+				edits = append(edits, edit{outStart: keyOffset, outEnd: keyOffset, srcStart: offset(key), srcEnd: offset(key)})
+				mark(memberValueOffset(converted, keyOffset), value)
+				walk(value, memberPointer)
+			}
+		case yaml.SequenceNode:
+			for i, item := range node.Content {
+				itemPointer := pointer + "/" + strconv.Itoa(i)
+				mark(schema.Locate(converted, itemPointer), item)
+				walk(item, itemPointer)
+			}
+		}
+	}
+	mark(schema.Locate(converted, ""), root.Content[0])
+	walk(root.Content[0], "")
+
+	// json objects are written with sorted keys, so the edits are not in the order of the yaml document
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].outStart < edits[j].outStart
+	})
+	return &SourceMap{stages: [][]edit{edits}}
+}
+
+// memberValueOffset returns the offset of the value of the object member with its key at keyOffset
+func memberValueOffset(content []byte, keyOffset int64) int64 {
+	i := int(keyOffset)
+	if i >= len(content) || content[i] != '"' {
+		return keyOffset
+	}
+	for i++; i < len(content) && content[i] != '"'; i++ {
+		if content[i] == '\\' {
+			i++
+		}
+	}
+	for i++; i < len(content) && strings.ContainsRune(" \t\r\n:", rune(content[i])); i++ {
+	}
+	return int64(i)
+}
+
+// escapePointer escapes a key for use in a json pointer
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
@@ -0,0 +1,186 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/templating"
+	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+const gzipEncoding = "gzip"
+
+// manifestTransform is the code of a javascript transform stored in the manifest, by its digest.
+// With the gzip encoding the code is compressed and base64 encoded.
+type manifestTransform struct {
+	Encoding string `json:"encoding,omitempty"`
+	Code     string `json:"code"`
+}
+
+// renderTransform reads a javascript transform and inserts the variables like in the config files, transforms
+// named *.tmpl.js are go templates. The rendered code is stored in the manifest, so it can not hold secrets.
+// Template expressions left unresolved fail the rendering like in the config files.
+func (app *App) renderTransform(transformPath string, variables map[string]interface{}) ([]byte, error) {
+	code, problems, err := app.checkTransform(transformPath, variables)
+	if err != nil {
+		return nil, err
+	}
+	for _, problem := range problems {
+		utils.LogError(problem, app.Env.LogFormat)
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("the transform has %d unresolved template expressions", len(problems))
+	}
+	return code, nil
+}
+
+// checkTransform renders a javascript transform, and returns the template expressions left unresolved in it
+func (app *App) checkTransform(transformPath string, variables map[string]interface{}) ([]byte, []utils.ErrorDetails, error) {
+	source, err := utils.ReadFile(app.Env.TransformPath(transformPath))
+	if err != nil {
+		return nil, nil, err
+	}
+	var code []byte
+	var sourceMap *templating.SourceMap
+	if strings.Contains(filepath.Base(transformPath), ".tmpl.") {
+		funcs := app.T.Funcs(app.Env.Name(variables), app.Secrets)
+		code, sourceMap, err = app.T.ReplaceTemplateVariables(transformPath, source, variables, funcs)
+	} else {
+		code, sourceMap, err = app.T.ReplaceVariables(source, variables)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if utils.ContainsSecret(string(code)) {
+		return nil, nil, fmt.Errorf("the transform holds a secret, secrets can not be used in transforms as they are stored in the manifest")
+	}
+	relPath := filepath.ToSlash(filepath.Join(app.Env.Project.Transforms, transformPath))
+	problems := app.checkPlaceholders(relPath, &renderedFile{Source: source, Content: code, SourceMap: sourceMap})
+	return code, problems, nil
+}
+
+// checkTransformClient fails for typescript transforms when the client can not compile them, so that
+// the deployment stops before anything is changed in the datahub
+func (app *App) checkTransformClient(transformPath string) error {
+	if strings.HasSuffix(transformPath, ".ts") && app.Env.ClientBackend == "http" {
+		return fmt.Errorf("typescript transform '%s' must be compiled by the mim client, use --client=mim or --client=auto", transformPath)
+	}
+	return nil
+}
+
+// transformPath returns the path of the javascript transform of a job, or an empty path when the code is inline
+func transformPath(jsonContent map[string]interface{}) string {
+	path, _ := jsonContent["transform"].(map[string]interface{})["Path"].(string)
+	return path
+}
+
+// inlineTransform takes the base64 encoded code of an inline javascript transform out of a job, as it is stored
+// with the other transforms in the manifest and deployed like them
+func inlineTransform(jsonContent map[string]interface{}) ([]byte, error) {
+	transform := jsonContent["transform"].(map[string]interface{})
+	encoded, _ := transform["Code"].(string)
+	code, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("the inline transform is not base64 encoded: %w", err)
+	}
+	if utils.ContainsSecret(string(code)) {
+		return nil, fmt.Errorf("the transform holds a secret, secrets can not be used in transforms as they are stored in the manifest")
+	}
+	delete(transform, "Code")
+	return code, nil
+}
+
+// digestCode returns the digest of the code of a transform
+func digestCode(code []byte) string {
+	hasher := md5.New()
+	hasher.Write(code)
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// readTransform returns the path and the code of the javascript transform of a job, as rendered when the
+// configs were read or as stored in the manifest being deployed. Inline transforms are named after the job.
+func (app *App) readTransform(c config) (string, []byte, error) {
+	transformPath := transformPath(c.JsonContent)
+	if transformPath == "" {
+		transformPath = c.Id + ".js"
+	}
+	code, ok := app.transforms[c.TransformDigest]
+	if !ok {
+		return transformPath, nil, fmt.Errorf("the transform of job '%s' is not stored in the manifest", c.Id)
+	}
+	return transformPath, code, nil
+}
+
+// manifestTransforms returns the code of the transforms of the jobs in the configs, for storing in the manifest.
+// Transforms of jobs deployed by older versions may be unknown, they are left out.
+func (app *App) manifestTransforms(configs map[string]config) (map[string]manifestTransform, error) {
+	transforms := make(map[string]manifestTransform)
+	for _, c := range configs {
+		if !hasJSTransform(c.JsonContent) {
+			continue
+		}
+		code, ok := app.transforms[c.TransformDigest]
+		if !ok {
+			continue
+		}
+		transform, err := encodeTransform(code, app.Env.CompressTransforms)
+		if err != nil {
+			return nil, err
+		}
+		transforms[c.TransformDigest] = transform
+	}
+	return transforms, nil
+}
+
+// transformCode returns the decoded code of the transforms stored in the manifest, by digest
+func (m Manifest) transformCode() (map[string][]byte, error) {
+	code := make(map[string][]byte, len(m.Transforms))
+	for digest, transform := range m.Transforms {
+		decoded, err := transform.decode()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read transform '%s' from the manifest: %w", digest, err)
+		}
+		code[digest] = decoded
+	}
+	return code, nil
+}
+
+func encodeTransform(code []byte, compress bool) (manifestTransform, error) {
+	if !compress {
+		return manifestTransform{Code: string(code)}, nil
+	}
+	var buf bytes.Buffer
+	writer := gzip.NewWriter(&buf)
+	if _, err := writer.Write(code); err != nil {
+		return manifestTransform{}, err
+	}
+	if err := writer.Close(); err != nil {
+		return manifestTransform{}, err
+	}
+	return manifestTransform{Encoding: gzipEncoding, Code: base64.StdEncoding.EncodeToString(buf.Bytes())}, nil
+}
+
+func (t manifestTransform) decode() ([]byte, error) {
+	switch t.Encoding {
+	case "":
+		return []byte(t.Code), nil
+	case gzipEncoding:
+		compressed, err := base64.StdEncoding.DecodeString(t.Code)
+		if err != nil {
+			return nil, err
+		}
+		reader, err := gzip.NewReader(bytes.NewReader(compressed))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return io.ReadAll(reader)
+	}
+	return nil, fmt.Errorf("unknown encoding '%s'", t.Encoding)
+}
@@ -0,0 +1,88 @@
+package app
+
+import (
+	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/environment"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/secrets"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/templating"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCheckTransform(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		code     string
+		abort    bool
+		want     string
+		problems []string
+	}{
+		{
+			name:  "variables",
+			file:  "t.js",
+			code:  "const g = \"{{ greeting }}\";",
+			abort: true,
+			want:  "const g = \"hello\";",
+		},
+		{
+			name:     "unresolved variable",
+			file:     "t.js",
+			code:     "const g = 1;\n// {{ typo }}\n",
+			abort:    true,
+			problems: []string{"transforms/t.js:2:4: Unresolved template expression {{ typo }}"},
+		},
+		{
+			name:     "missing variable in a go template",
+			file:     "t.tmpl.js",
+			code:     "const g = \"{{ .greeting }}\"; const t = \"{{ .typo }}\";",
+			abort:    true,
+			problems: []string{"transforms/t.tmpl.js:1:41: A variable used in the go template is missing from the env files"},
+		},
+		{
+			name: "unresolved variable only warned",
+			file: "t.js",
+			code: "// {{ typo }}",
+			want: "// {{ typo }}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			if err := os.MkdirAll(filepath.Join(root, "transforms"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(filepath.Join(root, "transforms", tt.file), []byte(tt.code), 0644); err != nil {
+				t.Fatal(err)
+			}
+			app := &App{
+				Env: &environment.Environment{
+					RootPath:             root,
+					Project:              &environment.Project{Transforms: "transforms"},
+					AbortOnMissingSecret: tt.abort,
+				},
+				T:       templating.NewTemplating(),
+				Secrets: secrets.NewEnvProvider(),
+			}
+			code, problems, err := app.checkTransform(tt.file, map[string]interface{}{"greeting": "hello"})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, problem := range problems {
+				got = append(got, fmt.Sprintf("%s:%d:%d: %s", problem.File, problem.Line, problem.Col, problem.Message))
+			}
+			if !reflect.DeepEqual(got, tt.problems) {
+				t.Errorf("problems = %q, want %q", got, tt.problems)
+			}
+			if len(tt.problems) == 0 && string(code) != tt.want {
+				t.Errorf("code = %q, want %q", code, tt.want)
+			}
+			if _, err := app.renderTransform(tt.file, map[string]interface{}{"greeting": "hello"}); (err != nil) != (len(tt.problems) > 0) {
+				t.Errorf("renderTransform() = %v, want an error only for unresolved expressions", err)
+			}
+		})
+	}
+}
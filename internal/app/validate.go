@@ -0,0 +1,180 @@
+package app
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/schema"
+	"github.com/mimiro-io/datahub-config-deployment/internal/app/templating"
+	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
+	"github.com/pterm/pterm"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Validate lints the config files offline, without connecting to the datahub
+func (app *App) Validate() error {
+	err := verifyEnv(app.Env.RootPath, app.Env.EnvironmentFiles)
+	if err != nil {
+		return err
+	}
+	files, err := app.Env.GetConfigFiles()
+	if err != nil {
+		return err
+	}
+	variables, err := app.Env.GetEnvironmentVariables()
+	if err != nil {
+		return err
+	}
+
+	var problems []utils.ErrorDetails
+	ids := make(map[string]string)
+	for _, file := range files {
+		relPath, err := filepath.Rel(app.Env.RootPath, file)
+		if err != nil {
+			relPath = file
+		}
+		problems = append(problems, app.validateFile(file, relPath, variables, ids)...)
+	}
+
+	for _, problem := range problems {
+		utils.LogError(problem, app.Env.LogFormat)
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("validation failed with %d errors in %d files", len(problems), len(files))
+	}
+	pterm.Success.Printf("Validated %d files without errors.\n", len(files))
+	return nil
+}
+
+// validateFile returns the problems found in a single config file. Ids already seen are
+// kept in ids, to detect configs sharing an id.
+func (app *App) validateFile(file string, relPath string, variables map[string]interface{}, ids map[string]string) []utils.ErrorDetails {
+	rendered, err := app.renderFile(file, variables)
+	if err != nil {
+		return []utils.ErrorDetails{{File: relPath, Message: "Failed to render file: " + err.Error()}}
+	}
+	// problem reports a message at the position of the value at pointer
+	problem := func(pointer string, format string, args ...interface{}) utils.ErrorDetails {
+		line, col := rendered.pointerPosition(pointer)
+		return utils.ErrorDetails{File: relPath, Line: line, Col: col, Message: fmt.Sprintf(format, args...)}
+	}
+
+	if problems := app.checkPlaceholders(relPath, rendered); len(problems) > 0 {
+		return problems
+	}
+	jsonContent, problems, err := checkConfig(relPath, rendered)
+	if err != nil {
+		return []utils.ErrorDetails{problem("", "Failed to validate file: %s", err.Error())}
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+
+	fileType, _ := jsonContent["type"].(string)
+	if fileType != "job" && fileType != "content" && fileType != "dataset" {
+		// files without a known type are only used through includes, and are never deployed
+		return nil
+	}
+
+	configType := app.Env.GetConfigType(file)
+	if configType == "unknown" {
+		problems = append(problems, problem("/type", "The %s is in a directory that is not deployed", fileType))
+	} else if configType != fileType {
+		problems = append(problems, problem("/type", "The %s is in the %s directory", fileType, configType))
+	}
+
+	idKey := "id"
+	if fileType == "dataset" {
+		idKey = "datasetName"
+	}
+	// the schema makes sure the id is set
+	id, _ := jsonContent[idKey].(string)
+	if other, exists := ids[id]; exists {
+		problems = append(problems, problem("/"+idKey, "The id '%s' is already used by %s", id, other))
+	} else {
+		ids[id] = relPath
+	}
+
+	if fileType == "job" && hasJSTransform(jsonContent) {
+		transformPath := transformPath(jsonContent)
+		if transformPath == "" {
+			code, _ := jsonContent["transform"].(map[string]interface{})["Code"].(string)
+			if _, err := base64.StdEncoding.DecodeString(code); err != nil {
+				problems = append(problems, problem("/transform/Code", "The inline transform is not base64 encoded"))
+			}
+		} else if _, err := os.Stat(app.Env.TransformPath(transformPath)); err != nil {
+			problems = append(problems, problem("/transform/Path", "The transform file '%s' does not exist in the transforms directory", transformPath))
+		} else if err := app.checkTransformClient(transformPath); err != nil {
+			problems = append(problems, problem("/transform/Path", "The %s", err.Error()))
+		} else if _, transformProblems, err := app.checkTransform(transformPath, variables); err != nil {
+			problems = append(problems, problem("/transform/Path", "Failed to render the transform '%s': %s", transformPath, err.Error()))
+		} else {
+			problems = append(problems, transformProblems...)
+		}
+	}
+	return problems
+}
+
+// checkConfig parses a rendered config file and checks it against the schema of its type.
+// The json content is only returned when the file has no problems.
+func checkConfig(relPath string, rendered *renderedFile) (map[string]interface{}, []utils.ErrorDetails, error) {
+	var jsonContent map[string]interface{}
+	if err := json.Unmarshal(rendered.Content, &jsonContent); err != nil {
+		line, col := 0, 0
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &syntaxErr) {
+			// the offset is just after the invalid character
+			line, col = rendered.position(max(syntaxErr.Offset-1, 0))
+		} else if errors.As(err, &typeErr) {
+			line, col = rendered.position(typeErr.Offset)
+		}
+		return nil, []utils.ErrorDetails{{File: relPath, Line: line, Col: col, Message: "Invalid json: " + err.Error()}}, nil
+	}
+
+	fileType, _ := jsonContent["type"].(string)
+	schemaProblems, err := schema.Validate(fileType, rendered.Content)
+	if err != nil {
+		return nil, nil, err
+	}
+	var problems []utils.ErrorDetails
+	for _, p := range schemaProblems {
+		line, col := rendered.position(p.Offset)
+		problems = append(problems, utils.ErrorDetails{File: relPath, Line: line, Col: col, Message: fmt.Sprintf("Invalid %s: %s", fileType, p.Message)})
+	}
+	if len(problems) > 0 {
+		return nil, problems, nil
+	}
+	return jsonContent, nil, nil
+}
+
+// checkPlaceholders finds the variables and expressions that templating left unresolved. They are returned
+// as problems when missing values abort the deployment, otherwise they are logged as warnings.
+func (app *App) checkPlaceholders(relPath string, rendered *renderedFile) []utils.ErrorDetails {
+	var problems []utils.ErrorDetails
+	for _, placeholder := range templating.FindPlaceholders(rendered.Content) {
+		line, col := rendered.position(placeholder.Offset)
+		message := fmt.Sprintf("Unresolved template expression %s", placeholder.Text)
+		if strings.HasPrefix(placeholder.Text, "{{ secret ") {
+			message = fmt.Sprintf("Secret %s not found by the %s secret provider", placeholder.Text, app.Secrets.Name())
+		} else if placeholder.Text == "<no value>" {
+			message = "A variable used in the go template is missing from the env files"
+		}
+		problems = append(problems, utils.ErrorDetails{
+			File:    relPath,
+			Line:    line,
+			Col:     col,
+			Message: message,
+		})
+	}
+	if app.Env.AbortOnMissingSecret {
+		return problems
+	}
+	for _, problem := range problems {
+		utils.LogWarning(problem, app.Env.LogFormat)
+	}
+	return nil
+}
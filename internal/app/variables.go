@@ -0,0 +1,50 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mimiro-io/datahub-config-deployment/internal/utils"
+	"github.com/pterm/pterm"
+	"path/filepath"
+)
+
+type variableSource struct {
+	Value  interface{} `json:"value"`
+	Source string      `json:"source"`
+}
+
+// Variables prints the variables merged from the env files, with the file each value came from
+func (app *App) Variables() error {
+	if len(app.Env.EnvironmentFiles) == 0 {
+		return errors.New("path to env variables is missing")
+	}
+	variables, err := app.Env.LoadVariables()
+	if err != nil {
+		return err
+	}
+
+	if app.Env.EnableJsonOut {
+		report := make(map[string]variableSource)
+		for _, path := range variables.Paths() {
+			report[path] = variableSource{Value: variables.Value(path), Source: variables.Sources[path]}
+		}
+		jsonReport, err := json.Marshal(report)
+		if err != nil {
+			return err
+		}
+		fmt.Println(utils.Redact(string(jsonReport)))
+		return nil
+	}
+
+	data := pterm.TableData{{"Variable", "Value", "Source"}}
+	for _, path := range variables.Paths() {
+		value, _ := json.Marshal(variables.Value(path))
+		source := variables.Sources[path]
+		if relPath, err := filepath.Rel(filepath.Dir(app.Env.EnvironmentFiles[0]), source); err == nil {
+			source = relPath
+		}
+		data = append(data, []string{path, utils.Redact(string(value)), source})
+	}
+	return pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+}
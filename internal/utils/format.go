@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/tidwall/pretty"
+	"gopkg.in/yaml.v3"
+	"path/filepath"
+	"strings"
+)
+
+// ConfigExtensions are the file extensions of config files
+var ConfigExtensions = []string{".json", ".jsonc", ".yaml", ".yml"}
+
+// IsYaml returns true if the file is a yaml file
+func IsYaml(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// IsJsonc returns true if the file is json with comments
+func IsJsonc(path string) bool {
+	return strings.ToLower(filepath.Ext(path)) == ".jsonc"
+}
+
+// YamlToJson converts a yaml document to indented json
+func YamlToJson(content []byte) ([]byte, error) {
+	var value interface{}
+	if err := yaml.Unmarshal(content, &value); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return pretty.Pretty(out.Bytes()), nil
+}
+
+// StripJsonComments turns json with comments and trailing commas into json. Comments and trailing
+// commas are replaced with spaces, so every value keeps its offset and line in the source.
+func StripJsonComments(content []byte) []byte {
+	out := make([]byte, len(content))
+	copy(out, content)
+
+	// blank is used to overwrite a comment, keeping the line breaks
+	blank := func(start int, end int) {
+		for i := start; i < end; i++ {
+			if out[i] != '\n' && out[i] != '\r' {
+				out[i] = ' '
+			}
+		}
+	}
+	inString := false
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		if inString {
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		switch {
+		case c == '"':
+			inString = true
+		case c == '/' && i+1 < len(out) && out[i+1] == '/':
+			end := bytes.IndexByte(out[i:], '\n')
+			if end < 0 {
+				end = len(out) - i
+			}
+			blank(i, i+end)
+			i += end - 1
+		case c == '/' && i+1 < len(out) && out[i+1] == '*':
+			end := bytes.Index(out[i+2:], []byte("*/"))
+			if end < 0 {
+				end = len(out) - i
+			} else {
+				end += 4
+			}
+			blank(i, i+end)
+			i += end - 1
+		}
+	}
+
+	// with the comments gone, a comma only followed by whitespace and a closing bracket is trailing
+	inString = false
+	for i := 0; i < len(out); i++ {
+		c := out[i]
+		if inString {
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+			continue
+		}
+		if c == '"' {
+			inString = true
+			continue
+		}
+		if c != ',' {
+			continue
+		}
+		next := i + 1
+		for next < len(out) && strings.IndexByte(" \t\r\n", out[next]) >= 0 {
+			next++
+		}
+		if next < len(out) && (out[next] == '}' || out[next] == ']') {
+			out[i] = ' '
+		}
+	}
+	return out
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestStripJsonComments(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "plain json",
+			content: `{"a": 1}`,
+			want:    `{"a": 1}`,
+		},
+		{
+			name:    "line comment",
+			content: "{\"a\": 1 // one\n}",
+			want:    "{\"a\": 1       \n}",
+		},
+		{
+			name:    "line comment at the end",
+			content: "{\"a\": 1}\n// end",
+			want:    "{\"a\": 1}\n      ",
+		},
+		{
+			name:    "block comment keeps line breaks",
+			content: "{/* one\ntwo */\"a\": 1}",
+			want:    "{      \n      \"a\": 1}",
+		},
+		{
+			name:    "unterminated block comment",
+			content: "{\"a\": 1} /* open",
+			want:    "{\"a\": 1}        ",
+		},
+		{
+			name:    "trailing comma in object",
+			content: "{\"a\": 1,\n}",
+			want:    "{\"a\": 1 \n}",
+		},
+		{
+			name:    "trailing comma in list",
+			content: `{"a": [1, 2, ]}`,
+			want:    `{"a": [1, 2  ]}`,
+		},
+		{
+			name:    "trailing comma before a comment",
+			content: "{\"a\": 1, // one\n}",
+			want:    "{\"a\": 1        \n}",
+		},
+		{
+			name:    "comment markers inside strings",
+			content: `{"url": "http://host/*path*/", "b": "// no"}`,
+			want:    `{"url": "http://host/*path*/", "b": "// no"}`,
+		},
+		{
+			name:    "comma and bracket inside strings",
+			content: `{"a": ",}", "b": ", ]"}`,
+			want:    `{"a": ",}", "b": ", ]"}`,
+		},
+		{
+			name:    "escaped quote inside strings",
+			content: `{"a": "say \"// hi\",}" /* c */}`,
+			want:    `{"a": "say \"// hi\",}"        }`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := string(StripJsonComments([]byte(tt.content)))
+			if got != tt.want {
+				t.Errorf("StripJsonComments(%q) = %q, want %q", tt.content, got, tt.want)
+			}
+			if len(got) != len(tt.content) {
+				t.Errorf("StripJsonComments(%q) changed the length from %d to %d", tt.content, len(tt.content), len(got))
+			}
+			if !json.Valid([]byte(got)) {
+				t.Errorf("StripJsonComments(%q) = %q is not valid json", tt.content, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package utils
+
+import (
+	"encoding/json"
+	"github.com/pterm/pterm"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const Mask = "***"
+
+var secrets = struct {
+	sync.Mutex
+	values []string
+}{}
+
+// RegisterSecret masks the value in everything logged from now on. In the github log format
+// the runner is asked to mask it as well, for output that does not pass through the log functions.
+func RegisterSecret(value string, logFormat string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	secrets.Lock()
+	defer secrets.Unlock()
+	for _, known := range secrets.values {
+		if known == value {
+			return
+		}
+	}
+
+	variants := []string{value}
+	// the value is also masked in the form it has inside json strings
+	if escaped, err := json.Marshal(value); err == nil && string(escaped[1:len(escaped)-1]) != value {
+		variants = append(variants, string(escaped[1:len(escaped)-1]))
+	}
+	secrets.values = append(secrets.values, variants...)
+	// longer values first, so a secret containing another secret is masked completely
+	sort.SliceStable(secrets.values, func(i, j int) bool {
+		return len(secrets.values[i]) > len(secrets.values[j])
+	})
+
+	if logFormat == "github" {
+		for _, variant := range variants {
+			for _, line := range strings.Split(variant, "\n") {
+				if strings.TrimSpace(line) != "" {
+					pterm.DefaultBasicText.Printf("::add-mask::%s\n", line)
+				}
+			}
+		}
+	}
+}
+
+// Redact replaces the registered secrets in text with a mask
+func Redact(text string) string {
+	secrets.Lock()
+	defer secrets.Unlock()
+	for _, value := range secrets.values {
+		text = strings.ReplaceAll(text, value, Mask)
+	}
+	return text
+}
+
+// ContainsSecret returns true if a registered secret is part of text
+func ContainsSecret(text string) bool {
+	secrets.Lock()
+	defer secrets.Unlock()
+	for _, value := range secrets.values {
+		if strings.Contains(text, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/pterm/pterm"
 	"io"
 	"io/ioutil"
@@ -29,7 +30,7 @@ func HandleError(err error) {
 			ShowLineNumber: false,
 		}
 
-		printer.Println(err.Error())
+		printer.Println(Redact(err.Error()))
 		pterm.Println()
 		os.Exit(1)
 	}
@@ -103,8 +104,26 @@ func ReadJson(rawJson []byte) (map[string]interface{}, error) {
 	return jsonContent, nil
 }
 
+// Position returns the 1-based line and column of a byte offset in content
+func Position(content []byte, offset int64) (int, int) {
+	if offset > int64(len(content)) {
+		offset = int64(len(content))
+	}
+	line, col := 1, 1
+	for _, b := range content[:offset] {
+		if b == '\n' {
+			line++
+			col = 1
+		} else {
+			col++
+		}
+	}
+	return line, col
+}
+
 func LogCommand(args []string, logFormat string, comment string) {
-	cmd := strings.Join(args, " ")
+	cmd := Redact(strings.Join(args, " "))
+	comment = Redact(comment)
 	switch logFormat {
 	case "github":
 		if comment != "" {
@@ -124,6 +143,7 @@ func LogCommand(args []string, logFormat string, comment string) {
 }
 
 func LogPlain(logString string, logFormat string) {
+	logString = Redact(logString)
 	switch logFormat {
 	case "github":
 		pterm.DefaultBasicText.Printf("::warning::%s\n", logString)
@@ -133,10 +153,56 @@ func LogPlain(logString string, logFormat string) {
 }
 
 func LogError(error ErrorDetails, logFormat string) {
+	error.Message = Redact(error.Message)
 	switch logFormat {
 	case "github":
 		pterm.DefaultBasicText.Printf("::error file=%s,line=%d,col=%d::%s\n", error.File, error.Line, error.Col, error.Message)
 	default:
-		pterm.DefaultParagraph.Println(error.Message)
+		location := error.File
+		if location != "" && error.Line > 0 {
+			location = fmt.Sprintf("%s:%d:%d", location, error.Line, error.Col)
+		}
+		if location != "" {
+			pterm.DefaultParagraph.Println(location + ": " + error.Message)
+		} else {
+			pterm.DefaultParagraph.Println(error.Message)
+		}
+	}
+}
+
+func LogWarning(warning ErrorDetails, logFormat string) {
+	warning.Message = Redact(warning.Message)
+	switch logFormat {
+	case "github":
+		pterm.DefaultBasicText.Printf("::warning file=%s,line=%d,col=%d::%s\n", warning.File, warning.Line, warning.Col, warning.Message)
+	default:
+		location := warning.File
+		if location != "" && warning.Line > 0 {
+			location = fmt.Sprintf("%s:%d:%d", location, warning.Line, warning.Col)
+		}
+		pterm.Warning.Println(location + ": " + warning.Message)
+	}
+}
+
+func LogGroup(title string, lines []string, logFormat string) {
+	title = Redact(title)
+	redacted := make([]string, len(lines))
+	for i, line := range lines {
+		redacted[i] = Redact(line)
+	}
+	lines = redacted
+	switch logFormat {
+	case "github":
+		pterm.DefaultBasicText.Printf("::group::%s\n", title)
+		for _, line := range lines {
+			pterm.DefaultBasicText.Printf("%s\n", line)
+		}
+		pterm.DefaultBasicText.Printf("::endgroup::\n")
+	default:
+		pterm.DefaultParagraph.Println(title)
+		for _, line := range lines {
+			pterm.Println("  " + line)
+		}
+		pterm.Println()
 	}
 }